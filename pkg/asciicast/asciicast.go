@@ -0,0 +1,128 @@
+// Package asciicast writes terminal sessions in asciinema asciicast v2 format,
+// see https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+package asciicast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	Version = 2
+
+	// event types
+	EventOutput = "o"
+	EventInput  = "i"
+	EventResize = "r"
+)
+
+// Header is the first line of a recording
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewWriter creates a writer of events happened since start, header is
+// written only if not nil (e.g. appending to an existing recording)
+func NewWriter(w io.Writer, start time.Time, header *Header) (*Writer, error) {
+	if header != nil {
+		header.Version = Version
+		header.Timestamp = start.Unix()
+
+		data, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Writer{w: w, start: start}, nil
+}
+
+// Writer writes events as lines of json, it's safe for concurrent use
+type Writer struct {
+	w     io.Writer
+	start time.Time
+
+	// incomplete utf-8 sequences at the end of last output and input
+	pendingOutput []byte
+	pendingInput  []byte
+
+	mu sync.Mutex
+}
+
+// Output records data written to the terminal
+func (w *Writer) Output(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writeData(EventOutput, &w.pendingOutput, data)
+}
+
+// Input records data read from the terminal
+func (w *Writer) Input(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writeData(EventInput, &w.pendingInput, data)
+}
+
+// Resize records size change of the terminal
+func (w *Writer) Resize(cols, rows uint16) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writeEvent(EventResize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// writeData records data as text, multi-byte characters split between
+// writes are recorded along with the rest of them
+func (w *Writer) writeData(eventType string, pending *[]byte, data []byte) error {
+	data = append(*pending, data...)
+
+	end := len(data)
+	// an utf-8 sequence is at most 4 bytes
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if !utf8.RuneStart(data[len(data)-i]) {
+			continue
+		}
+
+		if !utf8.FullRune(data[len(data)-i:]) {
+			end = len(data) - i
+		}
+		break
+	}
+
+	*pending = append([]byte(nil), data[end:]...)
+	if end == 0 {
+		return nil
+	}
+
+	return w.writeEvent(eventType, string(data[:end]))
+}
+
+func (w *Writer) writeEvent(eventType, data string) error {
+	line, err := json.Marshal([]interface{}{
+		// microsecond precision is enough
+		float64(time.Since(w.start)/time.Microsecond) / 1e6,
+		eventType,
+		data,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(append(line, '\n'))
+	return err
+}
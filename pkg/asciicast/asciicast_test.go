@@ -0,0 +1,91 @@
+package asciicast
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	start := time.Unix(1500000000, 0)
+	w, err := NewWriter(buf, start, &Header{Width: 80, Height: 24, Env: map[string]string{"TERM": "xterm"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accent, han := []byte("é"), []byte("世")
+	for _, f := range []func() error{
+		func() error { return w.Output([]byte("a")) },
+		// multi-byte characters split between writes
+		func() error { return w.Output(append([]byte("b"), accent[0])) },
+		func() error { return w.Output(append(accent[1:], han[:1]...)) },
+		func() error { return w.Output(han[1:2]) },
+		func() error { return w.Input(han[:2]) },
+		func() error { return w.Output(append(han[2:], 'c')) },
+		func() error { return w.Input(han[2:]) },
+		func() error { return w.Resize(120, 40) },
+	} {
+		if err := f(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	var header Header
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatal(err)
+	}
+	expectedHeader := Header{Version: 2, Width: 80, Height: 24, Timestamp: 1500000000, Env: map[string]string{"TERM": "xterm"}}
+	if !reflect.DeepEqual(header, expectedHeader) {
+		t.Errorf("expected header %+v, got %+v", expectedHeader, header)
+	}
+
+	var events [][2]string
+	for _, line := range lines[1:] {
+		var (
+			seconds         float64
+			eventType, data string
+		)
+		if err := json.Unmarshal([]byte(line), &[]interface{}{&seconds, &eventType, &data}); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if seconds <= 0 {
+			t.Errorf("unexpected event time %v", seconds)
+		}
+		events = append(events, [2]string{eventType, data})
+	}
+
+	expected := [][2]string{
+		{EventOutput, "a"},
+		{EventOutput, "b"},
+		{EventOutput, "é"},
+		{EventOutput, "世c"},
+		{EventInput, "世"},
+		{EventResize, "120x40"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+}
+
+func TestWriterAppend(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// invalid utf-8 is not held back
+	if err := w.Output([]byte{'a', 0xff}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(buf.String(), `,"o","a�"]`+"\n") || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("unexpected recording %q", buf.String())
+	}
+}
@@ -0,0 +1,95 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Event in a recording
+type Event struct {
+	// Time since the start of the recording
+	Time time.Duration
+	Type string
+	Data string
+}
+
+// NewReader reads the header of the recording
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+
+	line, err := reader.r.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(line, &reader.Header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %v", err)
+	}
+
+	if reader.Header.Version != Version {
+		return nil, fmt.Errorf("unsupported asciicast version %d", reader.Header.Version)
+	}
+
+	return reader, nil
+}
+
+// Reader reads events in a recording one by one
+type Reader struct {
+	Header Header
+
+	r *bufio.Reader
+}
+
+// Next returns the next event, io.EOF is returned at the end of the
+// recording, an incomplete last line (e.g. recording not finalized) is
+// treated as the end
+func (r *Reader) Next() (*Event, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		complete := err == nil
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if !complete {
+				return nil, io.EOF
+			}
+			continue
+		}
+
+		var (
+			seconds float64
+			event   = &Event{}
+		)
+		if err := json.Unmarshal(line, &[]interface{}{&seconds, &event.Type, &event.Data}); err != nil {
+			if !complete {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("invalid asciicast event %q: %v", line, err)
+		}
+
+		event.Time = time.Duration(seconds * float64(time.Second))
+		return event, nil
+	}
+}
+
+// ReadAll reads all events in the recording
+func (r *Reader) ReadAll() ([]*Event, error) {
+	var events []*Event
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+}
@@ -0,0 +1,401 @@
+package asciicast
+
+import (
+	"strconv"
+	"strings"
+)
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateCSI
+	// stateString is in an OSC, DCS, APC, PM or SOS string
+	stateString
+	stateStringEscape
+	// stateCharset skips the charset designated
+	stateCharset
+)
+
+// NewScreen creates a screen of the size
+func NewScreen(cols, rows int) *Screen {
+	s := &Screen{}
+	s.Resize(cols, rows)
+	return s
+}
+
+// Screen emulates text content of a terminal, it's a minimal emulator only
+// handling common cursor movement, erasing, scrolling and alternate screen,
+// attributes and colors are ignored, all characters are assumed to be of
+// single width
+type Screen struct {
+	cols, rows int
+
+	lines    [][]rune
+	mainLine [][]rune // main screen lines saved while in alternate screen
+	x, y     int
+	savedX   int
+	savedY   int
+	// wrapPending is set after writing the last column, the next character
+	// is written to the next line
+	wrapPending bool
+
+	scrollTop, scrollBottom int
+
+	state  parserState
+	params []byte
+}
+
+// Resize the screen, content out of new size is dropped
+func (s *Screen) Resize(cols, rows int) {
+	if cols <= 0 {
+		cols = 80
+	}
+	if rows <= 0 {
+		rows = 24
+	}
+
+	s.lines = resizeLines(s.lines, cols, rows)
+	if s.mainLine != nil {
+		s.mainLine = resizeLines(s.mainLine, cols, rows)
+	}
+
+	s.cols, s.rows = cols, rows
+	s.x, s.y = clamp(s.x, 0, cols-1), clamp(s.y, 0, rows-1)
+	s.scrollTop, s.scrollBottom = 0, rows-1
+	s.wrapPending = false
+}
+
+func resizeLines(lines [][]rune, cols, rows int) [][]rune {
+	// keep the bottom lines like terminals do when shrinking
+	if len(lines) > rows {
+		lines = lines[len(lines)-rows:]
+	}
+
+	result := make([][]rune, rows)
+	for i := range result {
+		result[i] = blankLine(cols)
+		if i < len(lines) {
+			copy(result[i], lines[i])
+		}
+	}
+	return result
+}
+
+// String returns text on the screen, trailing spaces and empty lines are
+// trimmed
+func (s *Screen) String() string {
+	lines := make([]string, len(s.lines))
+	for i, l := range s.lines {
+		lines[i] = strings.TrimRight(string(l), " ")
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// Write data output to the terminal
+func (s *Screen) Write(data string) {
+	for _, r := range data {
+		switch s.state {
+		case stateGround:
+			s.ground(r)
+		case stateEscape:
+			s.escape(r)
+		case stateCSI:
+			s.csi(r)
+		case stateString:
+			switch r {
+			case 0x07:
+				s.state = stateGround
+			case 0x1b:
+				s.state = stateStringEscape
+			}
+		case stateStringEscape:
+			// ESC \ terminates the string
+			s.state = stateGround
+		case stateCharset:
+			s.state = stateGround
+		}
+	}
+}
+
+func (s *Screen) ground(r rune) {
+	switch {
+	case r == 0x1b:
+		s.state = stateEscape
+	case r == '\b':
+		s.moveTo(s.x-1, s.y)
+	case r == '\t':
+		s.moveTo((s.x/8+1)*8, s.y)
+	case r == '\n', r == '\v', r == '\f':
+		s.lineFeed()
+	case r == '\r':
+		s.moveTo(0, s.y)
+	case r < 0x20, r == 0x7f:
+	default:
+		if s.wrapPending {
+			s.x, s.wrapPending = 0, false
+			s.lineFeed()
+		}
+
+		s.lines[s.y][s.x] = r
+		if s.x == s.cols-1 {
+			s.wrapPending = true
+		} else {
+			s.x++
+		}
+	}
+}
+
+func (s *Screen) escape(r rune) {
+	s.state = stateGround
+	switch r {
+	case '[':
+		s.state, s.params = stateCSI, s.params[:0]
+	case ']', 'P', 'X', '^', '_':
+		s.state = stateString
+	case '(', ')', '*', '+':
+		s.state = stateCharset
+	case '7':
+		s.savedX, s.savedY = s.x, s.y
+	case '8':
+		s.moveTo(s.savedX, s.savedY)
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.moveTo(0, s.y)
+		s.lineFeed()
+	case 'M':
+		s.wrapPending = false
+		if s.y == s.scrollTop {
+			s.scrollDown(1)
+		} else {
+			s.moveTo(s.x, s.y-1)
+		}
+	case 'c':
+		s.lines, s.mainLine = nil, nil
+		s.x, s.y = 0, 0
+		s.Resize(s.cols, s.rows)
+	}
+}
+
+func (s *Screen) csi(r rune) {
+	if r >= 0x20 && r <= 0x3f {
+		s.params = append(s.params, byte(r))
+		return
+	}
+
+	s.state = stateGround
+	if r < 0x40 || r > 0x7e {
+		return
+	}
+
+	params := string(s.params)
+	if strings.HasPrefix(params, "?") {
+		s.privateMode(r, strings.Split(params[1:], ";"))
+		return
+	}
+
+	if params != "" && (params[0] < '0' || params[0] > ';') {
+		// other private sequences
+		return
+	}
+
+	args := strings.Split(params, ";")
+	n := csiArg(args, 0, 1)
+	switch r {
+	case 'A':
+		s.moveTo(s.x, s.y-n)
+	case 'B', 'e':
+		s.moveTo(s.x, s.y+n)
+	case 'C', 'a':
+		s.moveTo(s.x+n, s.y)
+	case 'D':
+		s.moveTo(s.x-n, s.y)
+	case 'E':
+		s.moveTo(0, s.y+n)
+	case 'F':
+		s.moveTo(0, s.y-n)
+	case 'G', '`':
+		s.moveTo(n-1, s.y)
+	case 'd':
+		s.moveTo(s.x, n-1)
+	case 'H', 'f':
+		s.moveTo(csiArg(args, 1, 1)-1, n-1)
+	case 'J':
+		s.eraseDisplay(csiArg(args, 0, 0))
+	case 'K':
+		s.eraseLine(csiArg(args, 0, 0))
+	case 'L':
+		if s.y >= s.scrollTop && s.y <= s.scrollBottom {
+			s.scroll(s.y, s.scrollBottom, -n)
+		}
+	case 'M':
+		if s.y >= s.scrollTop && s.y <= s.scrollBottom {
+			s.scroll(s.y, s.scrollBottom, n)
+		}
+	case 'P':
+		line := s.lines[s.y]
+		n = clamp(n, 0, s.cols-s.x)
+		copy(line[s.x:], line[s.x+n:])
+		fill(line[s.cols-n:])
+	case '@':
+		line := s.lines[s.y]
+		n = clamp(n, 0, s.cols-s.x)
+		copy(line[s.x+n:], line[s.x:])
+		fill(line[s.x : s.x+n])
+	case 'X':
+		n = clamp(n, 0, s.cols-s.x)
+		fill(s.lines[s.y][s.x : s.x+n])
+	case 'S':
+		s.scrollUp(n)
+	case 'T':
+		s.scrollDown(n)
+	case 'r':
+		top, bottom := csiArg(args, 0, 1)-1, csiArg(args, 1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.scrollTop, s.scrollBottom = top, bottom
+		}
+		s.moveTo(0, 0)
+	case 's':
+		s.savedX, s.savedY = s.x, s.y
+	case 'u':
+		s.moveTo(s.savedX, s.savedY)
+	}
+}
+
+// privateMode handles switching to and from alternate screen
+func (s *Screen) privateMode(r rune, args []string) {
+	if r != 'h' && r != 'l' {
+		return
+	}
+
+	for _, arg := range args {
+		switch arg {
+		case "47", "1047", "1049":
+		default:
+			continue
+		}
+
+		switch {
+		case r == 'h' && s.mainLine == nil:
+			if arg == "1049" {
+				s.savedX, s.savedY = s.x, s.y
+			}
+			s.mainLine, s.lines = s.lines, resizeLines(nil, s.cols, s.rows)
+		case r == 'l' && s.mainLine != nil:
+			s.lines, s.mainLine = s.mainLine, nil
+			if arg == "1049" {
+				s.moveTo(s.savedX, s.savedY)
+			}
+		}
+	}
+}
+
+func (s *Screen) moveTo(x, y int) {
+	s.x, s.y = clamp(x, 0, s.cols-1), clamp(y, 0, s.rows-1)
+	s.wrapPending = false
+}
+
+func (s *Screen) lineFeed() {
+	if s.y == s.scrollBottom {
+		s.scrollUp(1)
+	} else if s.y < s.rows-1 {
+		s.y++
+	}
+}
+
+func (s *Screen) scrollUp(n int) {
+	s.scroll(s.scrollTop, s.scrollBottom, n)
+}
+
+func (s *Screen) scrollDown(n int) {
+	s.scroll(s.scrollTop, s.scrollBottom, -n)
+}
+
+// scroll lines between top and bottom up by n lines, down if n is negative
+func (s *Screen) scroll(top, bottom, n int) {
+	region := s.lines[top : bottom+1]
+	switch {
+	case n > 0:
+		n = clamp(n, 0, len(region))
+		copy(region, region[n:])
+		for i := len(region) - n; i < len(region); i++ {
+			region[i] = blankLine(s.cols)
+		}
+	case n < 0:
+		n = clamp(-n, 0, len(region))
+		copy(region[n:], region)
+		for i := 0; i < n; i++ {
+			region[i] = blankLine(s.cols)
+		}
+	}
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for _, l := range s.lines[s.y+1:] {
+			fill(l)
+		}
+	case 1:
+		s.eraseLine(1)
+		for _, l := range s.lines[:s.y] {
+			fill(l)
+		}
+	case 2, 3:
+		for _, l := range s.lines {
+			fill(l)
+		}
+	}
+}
+
+func (s *Screen) eraseLine(mode int) {
+	line := s.lines[s.y]
+	switch mode {
+	case 0:
+		fill(line[s.x:])
+	case 1:
+		fill(line[:s.x+1])
+	case 2:
+		fill(line)
+	}
+}
+
+// csiArg returns the i-th numeric argument, def if not provided or 0
+func csiArg(args []string, i, def int) int {
+	if i >= len(args) {
+		return def
+	}
+
+	n, err := strconv.Atoi(args[i])
+	if err != nil || n == 0 {
+		return def
+	}
+	return n
+}
+
+func blankLine(cols int) []rune {
+	line := make([]rune, cols)
+	fill(line)
+	return line
+}
+
+func fill(line []rune) {
+	for i := range line {
+		line[i] = ' '
+	}
+}
+
+func clamp(n, min, max int) int {
+	switch {
+	case n < min:
+		return min
+	case n > max:
+		return max
+	default:
+		return n
+	}
+}
@@ -0,0 +1,48 @@
+package asciicast
+
+import (
+	"testing"
+)
+
+func TestScreen(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		cols, rows int
+		output     string
+		expected   string
+	}{
+		{"text", 10, 3, "hello\r\nworld", "hello\nworld"},
+		{"wrap", 4, 3, "abcdef", "abcd\nef"},
+		{"scroll", 5, 2, "a\r\nb\r\nc", "b\nc"},
+		{"backspace", 10, 2, "abc\b\bX", "aXc"},
+		{"carriage return", 10, 2, "abc\rX", "Xbc"},
+		{"tab", 20, 2, "a\tb", "a       b"},
+		{"cursor position", 10, 3, "\x1b[2;3Hx", "\n  x"},
+		{"cursor movement", 10, 3, "\x1b[2Bx\x1b[Ay\x1b[3Cz\x1b[5Dw", "\n w   z\nx"},
+		{"erase line", 10, 2, "abcdef\x1b[3G\x1b[K", "ab"},
+		{"erase line start", 10, 2, "abcdef\x1b[3G\x1b[1K", "   def"},
+		{"erase display", 10, 2, "abc\r\ndef\x1b[2J", ""},
+		{"delete chars", 10, 2, "abcdef\x1b[2G\x1b[2P", "adef"},
+		{"insert chars", 10, 2, "abc\x1b[2G\x1b[2@", "a  bc"},
+		{"erase chars", 10, 2, "abcdef\x1b[2G\x1b[2X", "a  def"},
+		{"erase chars overflow", 10, 2, "abcdef\x1b[3G\x1b[9223372036854775807X", "ab"},
+		{"delete chars overflow", 10, 2, "abcdef\x1b[3G\x1b[9223372036854775807P", "ab"},
+		{"insert chars overflow", 10, 2, "abcdef\x1b[3G\x1b[9223372036854775807@", "ab"},
+		{"cursor overflow", 10, 2, "\x1b[9223372036854775807;9223372036854775807Hx", "\n         x"},
+		{"osc ignored", 10, 2, "\x1b]0;title\x07ab\x1b]0;t\x1b\\c", "abc"},
+		{"charset ignored", 10, 2, "\x1b(Bab", "ab"},
+		{"sgr ignored", 10, 2, "\x1b[1;31mab\x1b[0m", "ab"},
+		{"alternate screen", 10, 2, "main\x1b[?1049hvim\x1b[?1049l", "main"},
+		{"reset", 10, 2, "abc\x1bcd", "d"},
+		{"scroll region", 5, 4, "top\r\n\x1b[2;3r\x1b[3;1Ha\r\nb\r\nc", "top\nb\nc"},
+		{"reverse index", 5, 3, "a\r\nb\x1b[H\x1bM", "\na\nb"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewScreen(c.cols, c.rows)
+			s.Write(c.output)
+			if actual := s.String(); actual != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, actual)
+			}
+		})
+	}
+}
@@ -4,14 +4,22 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	krPty "github.com/kr/pty"
 	"golang.org/x/crypto/ssh/terminal"
 	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"arhat.dev/kube-host-pty/pkg/constant"
 	"arhat.dev/kube-host-pty/pkg/pty"
@@ -21,10 +29,21 @@ import (
 
 const (
 	Name = "pty-client"
+
+	// reattachMaxRetry limits attempts to attach again after connection lost
+	reattachMaxRetry = 20
+
+	// keepaliveInterval is the interval to send keepalive frames, the
+	// connection is considered lost if nothing received for keepaliveTimeout
+	keepaliveInterval = 15 * time.Second
+	keepaliveTimeout  = 3 * keepaliveInterval
 )
 
+// clientOptions are shared by all sub commands to find the session
+var clientOptions = &Options{}
+
 func NewCmd() (*util.Command, error) {
-	opt := &Options{}
+	opt := clientOptions
 	cmd := util.DefaultCmd(
 		Name, opt, nil,
 		func(ctx context.Context, exit context.CancelFunc) error {
@@ -32,48 +51,63 @@ func NewCmd() (*util.Command, error) {
 		})
 
 	cmd.Flags().StringVarP(&opt.Socket, "sock", "s", "", "set socket to use")
+	cmd.Flags().BoolVar(&opt.ReadOnly, "read-only", false, "attach as an observer, only watch output without input")
+
+	cmd.PersistentFlags().StringVar(&opt.Addr, "addr", "", "tcp address of pty-device-plugin serving sessions with mutual tls (e.g. node1:9443), the pts unix socket of the container is used if empty")
+	cmd.PersistentFlags().StringVar(&opt.Resource, "resource", constant.ResourceNamePty, "resource name of the device to connect over tcp")
+	cmd.PersistentFlags().StringVar(&opt.Device, "device", "", "id of the device to connect over tcp (e.g. pts0)")
+	cmd.PersistentFlags().StringVar(&opt.TLS.CAFile, "tls-ca-file", "", "ca certificate to verify pty-device-plugin, system roots are used if empty")
+	cmd.PersistentFlags().StringVar(&opt.TLS.CertFile, "tls-cert-file", "", "client certificate to present to pty-device-plugin")
+	cmd.PersistentFlags().StringVar(&opt.TLS.KeyFile, "tls-key-file", "", "private key of the client certificate")
+	cmd.PersistentFlags().StringVar(&opt.TLS.ServerName, "tls-server-name", "", "server name to verify the certificate of pty-device-plugin, defaults to host of --addr")
+
+	cmd.AddCommand(newExecCmd(cmd.Context), newCpCmd(cmd.Context), newForwardCmd(cmd.Context), newReplayCmd(cmd.Context))
 
 	return cmd, nil
 }
 
 func run(ctx context.Context, exit context.CancelFunc, opt *Options) error {
-	addr := os.Getenv(constant.EnvironNamePtsUnixSockFile)
-	conn, err := util.DialGRPC(ctx, "unix", addr, 5*time.Second, nil)
-	if err != nil {
-		return err
-	}
-
 	log.D("request attach to host pty")
-	c := pty.NewTerminalClient(conn)
-	client, err := c.Attach(ctx)
-	if err != nil {
+	remote := &remoteTerminal{readOnly: opt.ReadOnly}
+	if err := remote.attach(ctx); err != nil {
 		log.E("attach host pty failed", log.Err(err))
 		return err
 	}
 
-	// attached to host pty, prepare stdin for shell
-	oldState, err := terminal.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		log.E("make raw stdin failed", log.Err(err))
+	var (
+		oldState *terminal.State
+		err      error
+	)
+	if !opt.ReadOnly {
+		// attached to host pty, prepare stdin for shell
+		oldState, err = terminal.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			log.E("make raw stdin failed", log.Err(err))
+		}
+
+		// initial window resize
+		resizeRemotePtsForStdin(ctx, remote)
 	}
 
-	// initial window resize
-	resizeRemotePtsForStdin(ctx, c)
+	// exit code of this process, set to the remote one once the shell exited
+	exitCode := int32(0)
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, unix.SIGWINCH, os.Interrupt)
 	_ = util.Workers.Add(func(func()) (interface{}, error) {
 		defer func() {
 			exit()
-			<-time.AfterFunc(time.Second, func() { os.Exit(1) }).C
+			<-time.AfterFunc(time.Second, func() { os.Exit(int(atomic.LoadInt32(&exitCode))) }).C
 		}()
 
 		for {
 			select {
 			case <-ctx.Done():
-				_ = client.CloseSend()
-				// recover stdin
-				_ = terminal.Restore(int(os.Stdin.Fd()), oldState)
+				_ = remote.closeSend()
+				if oldState != nil {
+					// recover stdin
+					_ = terminal.Restore(int(os.Stdin.Fd()), oldState)
+				}
 				return nil, nil
 			case sig, more := <-sigCh:
 				if !more {
@@ -84,7 +118,9 @@ func run(ctx context.Context, exit context.CancelFunc, opt *Options) error {
 				case os.Interrupt:
 					return nil, nil
 				case unix.SIGWINCH:
-					resizeRemotePtsForStdin(ctx, c)
+					if !opt.ReadOnly {
+						resizeRemotePtsForStdin(ctx, remote)
+					}
 				}
 			}
 		}
@@ -95,26 +131,94 @@ func run(ctx context.Context, exit context.CancelFunc, opt *Options) error {
 		}()
 
 		// recv host pty output
+		observers := uint32(0)
 		for {
-			ptyOutput, err := client.Recv()
+			frame, err := remote.attachClient().Recv()
 			if err != nil {
+				if (status.Code(err) == codes.Unavailable || remote.aborted()) && ctx.Err() == nil {
+					// server stopped, the session may have been handed over
+					// to the upgraded device plugin, attach again
+					log.I("connection to host pty lost, attach again", log.Err(err))
+					if err = remote.reattach(ctx); err == nil {
+						if !opt.ReadOnly {
+							resizeRemotePtsForStdin(ctx, remote)
+						}
+						continue
+					}
+				}
+
+				if ctx.Err() != nil {
+					// exiting
+					return nil, nil
+				}
+
 				log.E("recv pts output failed", log.Err(err))
+				atomic.StoreInt32(&exitCode, 1)
 				return nil, err
 			}
 
-			output := ptyOutput.GetData()
-			_, err = io.Copy(os.Stdout, bytes.NewReader(output))
-			if err != nil {
-				log.E("copy host pty output to stdout failed", log.Err(err))
-				return nil, err
+			remote.received(frame)
+			switch f := frame.GetFrame().(type) {
+			case *pty.Frame_Presence:
+				if p := f.Presence; p.GetObservers() != observers {
+					observers = p.GetObservers()
+					_, _ = fmt.Fprintf(os.Stderr, "\r\n[pty-client] %d writer(s), %d observer(s) attached\r\n",
+						p.GetWriters(), p.GetObservers())
+				}
+			case *pty.Frame_Data:
+				_, err = io.Copy(os.Stdout, bytes.NewReader(f.Data))
+				if err != nil {
+					log.E("copy host pty output to stdout failed", log.Err(err))
+					return nil, err
+				}
+			case *pty.Frame_Resize:
+				log.D("host pty resized", log.Uint32("cols", f.Resize.GetCols()), log.Uint32("rows", f.Resize.GetRows()))
 			}
 
-			if ptyOutput.GetCompleted() {
+			if frame.GetCompleted() {
 				// remote shell application exited, exit now
+				atomic.StoreInt32(&exitCode, remoteExitCode(frame.GetExit()))
 				return nil, nil
 			}
 		}
-	}, func(func()) (interface{}, error) {
+	})
+
+	_ = util.Workers.Add(func(func()) (interface{}, error) {
+		ticker := time.NewTicker(keepaliveInterval)
+		defer ticker.Stop()
+
+		seq := uint64(0)
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, nil
+			case <-ticker.C:
+			}
+
+			if !remote.framed() {
+				continue
+			}
+
+			if remote.idle() > keepaliveTimeout {
+				log.I("host pty not responding, attach again")
+				remote.abort()
+				continue
+			}
+
+			seq++
+			err := remote.send(&pty.Frame{Frame: &pty.Frame_Keepalive{Keepalive: &pty.Keepalive{Seq: seq}}})
+			if err != nil {
+				log.D("send keepalive failed", log.Err(err))
+			}
+		}
+	})
+
+	if opt.ReadOnly {
+		// input is never sent, quit with interrupt
+		return nil
+	}
+
+	_ = util.Workers.Add(func(func()) (interface{}, error) {
 		defer func() {
 			exit()
 			_ = os.Stdout.Close()
@@ -124,8 +228,27 @@ func run(ctx context.Context, exit context.CancelFunc, opt *Options) error {
 		s := bufio.NewScanner(os.Stdin)
 		s.Split(util.ScanAnyAvail)
 
+		escape := &escapeFilter{}
 		for s.Scan() {
-			if err := client.Send(&pty.Bytes{Data: s.Bytes()}); err != nil {
+			data, signals, help := escape.filter(s.Bytes())
+			if help {
+				_, _ = fmt.Fprint(os.Stderr, escapeHelp)
+			}
+
+			for _, req := range signals {
+				sendRemoteSignal(ctx, remote, req)
+			}
+
+			if len(data) == 0 {
+				continue
+			}
+
+			if err := remote.send(&pty.Frame{Frame: &pty.Frame_Data{Data: data}}); err != nil {
+				if err == io.EOF {
+					// stream closed, input is dropped until attached again
+					continue
+				}
+
 				log.E("send user input failed", log.Err(err))
 				return nil, err
 			}
@@ -136,14 +259,213 @@ func run(ctx context.Context, exit context.CancelFunc, opt *Options) error {
 	return nil
 }
 
-func resizeRemotePtsForStdin(ctx context.Context, c pty.TerminalClient) {
+// sendRemoteSignal sends signal in the attach stream if supported by the
+// server, or with the Signal rpc otherwise, which reports pids signaled
+func sendRemoteSignal(ctx context.Context, remote *remoteTerminal, req *pty.SignalRequest) {
+	target := "foreground processes"
+	if req.GetSession() {
+		target = "all processes in session"
+	}
+
+	if remote.framed() {
+		if err := remote.send(&pty.Frame{Frame: &pty.Frame_Signal{Signal: req}}); err != nil {
+			log.E("send signal failed", log.String("signal", req.GetName().String()), log.Err(err))
+			_, _ = fmt.Fprintf(os.Stderr, "\r\n[pty-client] send SIG%s to %s failed: %v\r\n", req.GetName(), target, err)
+			return
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "\r\n[pty-client] sent SIG%s to %s\r\n", req.GetName(), target)
+		return
+	}
+
+	resp, err := remote.terminalClient().Signal(ctx, req)
+	if err != nil {
+		log.E("send signal failed", log.String("signal", req.GetName().String()), log.Err(err))
+		_, _ = fmt.Fprintf(os.Stderr, "\r\n[pty-client] send SIG%s to %s failed: %v\r\n", req.GetName(), target, err)
+		return
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "\r\n[pty-client] sent SIG%s to %s %v\r\n", req.GetName(), target, resp.GetPids())
+}
+
+// remoteExitCode converts exit status of remote shell to exit code of this
+// process, the same as shells do
+func remoteExitCode(exit *pty.Exit) int32 {
+	if exit == nil {
+		return 0
+	}
+
+	if exit.GetReason() != pty.ExitReason_SHELL_EXITED {
+		_, _ = fmt.Fprintf(os.Stderr, "\r\n[pty-client] session closed: %s\r\n",
+			strings.ToLower(strings.Replace(exit.GetReason().String(), "_", " ", -1)))
+	}
+
+	switch {
+	case exit.GetSignal() != 0:
+		return 128 + exit.GetSignal()
+	case exit.GetCode() < 0:
+		return 1
+	default:
+		return exit.GetCode()
+	}
+}
+
+// remoteTerminal is the connection to host pty, which can be attached again
+// once lost
+type remoteTerminal struct {
+	readOnly bool
+
+	conn   *grpc.ClientConn
+	client pty.TerminalClient
+	stream pty.Terminal_AttachClient
+	// hello is sent by the server as the first frame, control frames are
+	// only sent to servers supporting them
+	hello *pty.Hello
+	// lastRecv is the time the last frame received
+	lastRecv time.Time
+	// lost is set when the connection is aborted for not responding
+	lost bool
+	mu   sync.RWMutex
+
+	// sendMu serializes frames sent to the stream
+	sendMu sync.Mutex
+}
+
+func (r *remoteTerminal) attach(ctx context.Context) error {
+	conn, err := dialTerminal(ctx)
+	if err != nil {
+		return err
+	}
+
+	attachCtx := ctx
+	if r.readOnly {
+		attachCtx = metadata.AppendToOutgoingContext(ctx, pty.MetadataKeyAttachMode, pty.AttachModeReadOnly)
+	}
+
+	client := pty.NewTerminalClient(conn)
+	stream, err := client.Attach(attachCtx)
+	if err == nil {
+		err = stream.Send(&pty.Frame{Frame: &pty.Frame_Hello{Hello: pty.NewHello(clientCapabilities)}})
+	}
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	r.sendMu.Lock()
+	r.mu.Lock()
+	oldConn := r.conn
+	r.conn, r.client, r.stream = conn, client, stream
+	r.hello, r.lastRecv, r.lost = nil, time.Now(), false
+	r.mu.Unlock()
+	r.sendMu.Unlock()
+
+	if oldConn != nil {
+		_ = oldConn.Close()
+	}
+	return nil
+}
+
+// reattach retries for a while since the pts server may not be ready yet
+func (r *remoteTerminal) reattach(ctx context.Context) error {
+	return util.RetryWithBackoff(ctx, 100*time.Millisecond, 2*time.Second, reattachMaxRetry, func() error {
+		return r.attach(ctx)
+	})
+}
+
+// abort the connection, the client should attach again
+func (r *remoteTerminal) abort() {
+	r.mu.Lock()
+	// no control frames until attached again
+	r.lost, r.hello = true, nil
+	conn := r.conn
+	r.mu.Unlock()
+
+	_ = conn.Close()
+}
+
+func (r *remoteTerminal) aborted() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lost
+}
+
+// received is called with every frame received
+func (r *remoteTerminal) received(frame *pty.Frame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastRecv = time.Now()
+	if hello := frame.GetHello(); hello != nil {
+		log.D("attached", log.String("plugin_version", hello.GetVersion()), log.Strings("plugin_capabilities", hello.GetCapabilities()))
+		r.hello = hello
+	}
+}
+
+// framed returns true if the server supports control frames
+func (r *remoteTerminal) framed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.hello.HasCapability(pty.CapabilityControlFrames)
+}
+
+// idle returns time elapsed since the last frame received
+func (r *remoteTerminal) idle() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return time.Since(r.lastRecv)
+}
+
+func (r *remoteTerminal) send(frame *pty.Frame) error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+
+	return r.attachClient().Send(frame)
+}
+
+func (r *remoteTerminal) closeSend() error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+
+	return r.attachClient().CloseSend()
+}
+
+func (r *remoteTerminal) terminalClient() pty.TerminalClient {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.client
+}
+
+func (r *remoteTerminal) attachClient() pty.Terminal_AttachClient {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.stream
+}
+
+// resizeRemotePtsForStdin resizes host pty in the attach stream if supported
+// by the server, or with the Resize rpc otherwise
+func resizeRemotePtsForStdin(ctx context.Context, remote *remoteTerminal) {
 	rows, cols, err := krPty.Getsize(os.Stdin)
 	if err != nil {
 		log.E("get stdin pty size failed", log.Err(err))
 		return
 	}
 
-	hostPtySize, err := c.Resize(ctx, &pty.Size{Cols: uint32(cols), Rows: uint32(rows)})
+	size := &pty.Size{Cols: uint32(cols), Rows: uint32(rows)}
+	if remote.framed() {
+		// size resulted is replied in the stream
+		if err := remote.send(&pty.Frame{Frame: &pty.Frame_Resize{Resize: size}}); err != nil {
+			log.I("resize pty failed", log.Err(err), log.Int("stdin_cols", cols), log.Int("stdin_rows", rows))
+		}
+		return
+	}
+
+	hostPtySize, err := remote.terminalClient().Resize(ctx, size)
 	if err != nil {
 		log.I("resize pty failed", log.Err(err),
 			log.Uint32("host_cols", hostPtySize.GetCols()),
@@ -152,3 +474,23 @@ func resizeRemotePtsForStdin(ctx context.Context, c pty.TerminalClient) {
 			log.Int("stdin_rows", rows))
 	}
 }
+
+// dialTerminal connects to the host pty allocated to this container, or
+// the one selected by `--device` over tcp if `--addr` provided
+func dialTerminal(ctx context.Context) (*grpc.ClientConn, error) {
+	opt := clientOptions
+	if opt.Addr == "" {
+		return util.DialGRPC(ctx, "unix", os.Getenv(constant.EnvironNamePtsUnixSockFile), 5*time.Second, nil, dialOptions...)
+	}
+
+	if opt.Device == "" {
+		return nil, fmt.Errorf("device is required to connect over tcp")
+	}
+
+	tlsConfig, err := util.NewClientTLSConfig(opt.TLS.CAFile, opt.TLS.CertFile, opt.TLS.KeyFile, opt.TLS.ServerName)
+	if err != nil {
+		return nil, fmt.Errorf("load tls config failed: %v", err)
+	}
+
+	return util.DialGRPC(ctx, "tcp", opt.Addr, 5*time.Second, tlsConfig, dialOptions...)
+}
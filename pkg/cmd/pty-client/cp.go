@@ -0,0 +1,309 @@
+package ptycli
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util"
+)
+
+const (
+	// hostPathPrefix marks paths on the host
+	hostPathPrefix = "host:"
+
+	copyChunkSize = 32 * 1024
+)
+
+type copyOptions struct {
+	resume     bool
+	noPreserve bool
+	owner      string
+}
+
+func newCpCmd(ctx context.Context) *cobra.Command {
+	opt := &copyOptions{}
+	cmd := &cobra.Command{
+		Use:   "cp SRC DEST",
+		Short: "copy files and directories between local and host",
+		Long: `copy files and directories between local and host, paths on host are
+prefixed with "host:", relative ones are relative to home dir of the shell user
+
+a directory is copied as DEST with its content, DEST ending with "/" refers
+to a file or directory named as base name of SRC in it
+
+  # copy local file to /tmp/bar on host
+  pty-client cp /tmp/foo host:/tmp/bar
+  # copy local directory to /tmp/foo-dir on host
+  pty-client cp /tmp/foo-dir host:/tmp/
+  # copy file in home dir of the shell user to local
+  pty-client cp host:.bash_history ./bash_history`,
+		Args: cobra.ExactArgs(2),
+		// errors are printed by main
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			src, dest := args[0], args[1]
+			srcOnHost, destOnHost := strings.HasPrefix(src, hostPathPrefix), strings.HasPrefix(dest, hostPathPrefix)
+			switch {
+			case srcOnHost == destOnHost:
+				return fmt.Errorf("one and only one of SRC and DEST must be on host (prefixed with %q)", hostPathPrefix)
+			case destOnHost:
+				return unsupported(upload(ctx, src, strings.TrimPrefix(dest, hostPathPrefix), opt), pty.CapabilityFileTransfer)
+			default:
+				return unsupported(download(ctx, strings.TrimPrefix(src, hostPathPrefix), dest, opt), pty.CapabilityFileTransfer)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&opt.resume, "resume", false, "continue copying regular file from where the partial one ends")
+	cmd.Flags().BoolVar(&opt.noPreserve, "no-preserve", false, "do not preserve permission bits of files copied")
+	cmd.Flags().StringVar(&opt.owner, "owner", "", "owner of files copied to host in form of [user][:group], defaults to the shell user")
+
+	return cmd
+}
+
+func upload(ctx context.Context, local, remote string, opt *copyOptions) error {
+	info, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(remote, "/") {
+		remote += filepath.Base(local)
+	}
+
+	header := &pty.FileHeader{Path: remote, Directory: info.IsDir(), Owner: opt.owner}
+	if !opt.noPreserve {
+		header.Mode = uint32(info.Mode().Perm())
+	}
+	if !info.IsDir() {
+		header.Size = info.Size()
+	}
+
+	conn, err := dialTerminal(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := requireCapability(ctx, conn, pty.CapabilityFileTransfer); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := pty.NewTerminalClient(conn).Upload(ctx)
+	if err != nil {
+		return err
+	}
+
+	// actual error is returned by Recv once the stream is closed by server
+	sendErr := func(err error) error {
+		if err == io.EOF {
+			_, err = stream.Recv()
+		}
+		return err
+	}
+
+	if err := stream.Send(&pty.UploadRequest{Header: header, Resume: opt.resume && !info.IsDir()}); err != nil {
+		return sendErr(err)
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	w := bufio.NewWriterSize(io.MultiWriter(h, &uploadWriter{stream: stream}), copyChunkSize)
+	if info.IsDir() {
+		err = util.WriteTar(w, local, !opt.noPreserve)
+	} else {
+		err = copyFileFrom(w, h, local, resp.Offset)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return sendErr(err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if err := stream.Send(&pty.UploadRequest{Sha256: sum}); err != nil {
+		return sendErr(err)
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	if resp, err = stream.Recv(); err != nil {
+		return err
+	}
+
+	if resp.Sha256 != sum {
+		return fmt.Errorf("checksum mismatch, expected %s, got %s", sum, resp.Sha256)
+	}
+
+	return nil
+}
+
+// copyFileFrom writes content of the file from offset to w, content before
+// offset is written to h only
+func copyFileFrom(w io.Writer, h hash.Hash, file string, offset int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.CopyN(h, f, offset); err != nil {
+		return fmt.Errorf("local file shorter than partial one: %v", err)
+	}
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// uploadWriter sends data written as upload requests
+type uploadWriter struct {
+	stream pty.Terminal_UploadClient
+}
+
+func (w *uploadWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&pty.UploadRequest{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func download(ctx context.Context, remote, local string, opt *copyOptions) error {
+	if info, err := os.Stat(local); strings.HasSuffix(local, "/") || (err == nil && info.IsDir()) {
+		local = filepath.Join(local, path.Base(remote))
+	}
+
+	offset := int64(0)
+	if opt.resume {
+		if info, err := os.Stat(local); err == nil && info.Mode().IsRegular() {
+			offset = info.Size()
+		}
+	}
+
+	conn, err := dialTerminal(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := requireCapability(ctx, conn, pty.CapabilityFileTransfer); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := pty.NewTerminalClient(conn).Download(ctx, &pty.DownloadRequest{Path: remote, Offset: offset})
+	if err != nil {
+		return err
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	header := resp.GetHeader()
+	if header == nil {
+		return fmt.Errorf("file header not received")
+	}
+
+	r := &downloadReader{stream: stream, hash: sha256.New()}
+	if header.Directory {
+		err = util.ExtractTar(r, local, nil)
+		if err == nil {
+			// consume paddings after the end of archive
+			_, err = io.Copy(ioutil.Discard, r)
+		}
+	} else {
+		err = copyFileTo(local, r, offset)
+	}
+	if err != nil {
+		return err
+	}
+
+	if sum := hex.EncodeToString(r.hash.Sum(nil)); r.checksum != sum {
+		return fmt.Errorf("checksum mismatch, expected %s, got %s", r.checksum, sum)
+	}
+
+	if opt.noPreserve {
+		return nil
+	}
+
+	return os.Chmod(local, os.FileMode(header.Mode).Perm())
+}
+
+// copyFileTo writes content of r to the file from offset, content before
+// offset is written to hash of r
+func copyFileTo(file string, r *downloadReader, offset int64) error {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.CopyN(r.hash, f, offset); err != nil {
+		return err
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// downloadReader reads data in download responses, and sums data read
+type downloadReader struct {
+	stream   pty.Terminal_DownloadClient
+	hash     hash.Hash
+	buf      []byte
+	checksum string
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		resp, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		r.buf = resp.Data
+		if resp.Sha256 != "" {
+			r.checksum = resp.Sha256
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	_, _ = r.hash.Write(p[:n])
+	return n, nil
+}
@@ -0,0 +1,65 @@
+package ptycli
+
+import (
+	"arhat.dev/kube-host-pty/pkg/pty"
+)
+
+const (
+	// escapeKey (Ctrl-]) starts an escape sequence, the key following it
+	// selects the action, press it twice to send itself
+	escapeKey = 0x1d
+)
+
+// escapeSignals maps keys following the escape key to signals sent to the
+// foreground process group, upper case ones are sent to the whole session
+var escapeSignals = map[byte]pty.SignalRequest_Name{
+	'c':  pty.SignalRequest_INT,
+	't':  pty.SignalRequest_TERM,
+	'k':  pty.SignalRequest_KILL,
+	'\\': pty.SignalRequest_QUIT,
+	'z':  pty.SignalRequest_TSTP,
+}
+
+const escapeHelp = "\r\n[pty-client] escape sequences (Ctrl-] followed by):\r\n" +
+	"  c  SIGINT    t  SIGTERM    k  SIGKILL    \\  SIGQUIT    z  SIGTSTP\r\n" +
+	"  upper case letters signal the whole session\r\n" +
+	"  Ctrl-]  send Ctrl-]    ?  this help\r\n"
+
+// escapeFilter extracts escape sequences from user input
+type escapeFilter struct {
+	escaping bool
+}
+
+// filter returns input to be sent, signals requested and whether help
+// requested, escape sequence may span across inputs
+func (e *escapeFilter) filter(input []byte) (data []byte, signals []*pty.SignalRequest, help bool) {
+	data = make([]byte, 0, len(input))
+	for _, b := range input {
+		if !e.escaping {
+			if b == escapeKey {
+				e.escaping = true
+			} else {
+				data = append(data, b)
+			}
+			continue
+		}
+
+		e.escaping = false
+		switch {
+		case b == escapeKey:
+			data = append(data, b)
+		case b == '?':
+			help = true
+		case b >= 'A' && b <= 'Z':
+			if name, ok := escapeSignals[b-'A'+'a']; ok {
+				signals = append(signals, &pty.SignalRequest{Name: name, Session: true})
+			}
+		default:
+			if name, ok := escapeSignals[b]; ok {
+				signals = append(signals, &pty.SignalRequest{Name: name})
+			}
+		}
+	}
+
+	return data, signals, help
+}
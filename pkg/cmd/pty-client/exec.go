@@ -0,0 +1,98 @@
+package ptycli
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+func newExecCmd(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "exec -- COMMAND [ARGS...]",
+		Short: "run a command on host without pty",
+		Args:  cobra.MinimumNArgs(1),
+		// errors are printed by main
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			code, err := runExec(ctx, args)
+			if err != nil {
+				return unsupported(err, pty.CapabilityExec)
+			}
+
+			os.Exit(int(code))
+			return nil
+		},
+	}
+}
+
+// runExec runs command on host with stdin, stdout and stderr forwarded,
+// returns exit code of the command
+func runExec(ctx context.Context, command []string) (int32, error) {
+	conn, err := dialTerminal(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := requireCapability(ctx, conn, pty.CapabilityExec); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := pty.NewTerminalClient(conn).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := stream.Send(&pty.ExecRequest{Command: command}); err != nil {
+		return 0, err
+	}
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				if stream.Send(&pty.ExecRequest{Stdin: buf[:n]}) != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				_ = stream.Send(&pty.ExecRequest{StdinClosed: true})
+				return
+			}
+		}
+	}()
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				log.E("exec stream closed without exit status")
+				return 1, nil
+			}
+			return 0, err
+		}
+
+		if _, err := os.Stdout.Write(resp.GetStdout()); err != nil {
+			return 0, err
+		}
+
+		if _, err := os.Stderr.Write(resp.GetStderr()); err != nil {
+			return 0, err
+		}
+
+		if exit := resp.GetExit(); exit != nil {
+			return remoteExitCode(exit), nil
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package ptycli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+// portForward forwards connections to the local port to the remote address
+type portForward struct {
+	localPort string
+	network   string
+	address   string
+}
+
+func newForwardCmd(ctx context.Context) *cobra.Command {
+	listenAddress := ""
+	cmd := &cobra.Command{
+		Use:   "forward LOCAL:REMOTE [LOCAL:REMOTE...]",
+		Short: "forward local ports to tcp or unix addresses on host",
+		Long: `forward local ports to tcp or unix addresses on host, LOCAL is a port
+to listen in this container, REMOTE is a port on host loopback, host:port,
+or path of a unix socket on host, LOCAL alone forwards to the same port
+
+  # forward local port 9100 to port 9100 on host loopback
+  pty-client forward 9100
+  # forward local port 8080 to 10.0.0.1:80 reachable from host
+  pty-client forward 8080:10.0.0.1:80
+  # forward local port 2375 to docker daemon on host
+  pty-client forward 2375:/var/run/docker.sock`,
+		Args: cobra.MinimumNArgs(1),
+		// errors are printed by main
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var forwards []portForward
+			for _, spec := range args {
+				f, err := parsePortForward(spec)
+				if err != nil {
+					return err
+				}
+				forwards = append(forwards, f)
+			}
+
+			return runForward(ctx, listenAddress, forwards)
+		},
+	}
+
+	cmd.Flags().StringVar(&listenAddress, "address", "127.0.0.1", "local address to listen")
+
+	return cmd
+}
+
+func parsePortForward(spec string) (portForward, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	f := portForward{localPort: parts[0], network: "tcp"}
+	if _, err := strconv.ParseUint(f.localPort, 10, 16); err != nil {
+		return f, fmt.Errorf("invalid local port in %q", spec)
+	}
+
+	remote := f.localPort
+	if len(parts) == 2 {
+		remote = parts[1]
+	}
+
+	switch {
+	case strings.HasPrefix(remote, "/"):
+		f.network, f.address = "unix", remote
+	case !strings.Contains(remote, ":"):
+		f.address = net.JoinHostPort("127.0.0.1", remote)
+	default:
+		f.address = remote
+	}
+
+	return f, nil
+}
+
+func runForward(ctx context.Context, listenAddress string, forwards []portForward) error {
+	conn, err := dialTerminal(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := requireCapability(ctx, conn, pty.CapabilityPortForward); err != nil {
+		return err
+	}
+
+	client := pty.NewTerminalClient(conn)
+	errCh := make(chan error, len(forwards))
+	for _, f := range forwards {
+		l, err := net.Listen("tcp", net.JoinHostPort(listenAddress, f.localPort))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = l.Close() }()
+
+		fmt.Printf("Forwarding from %s -> %s\n", l.Addr(), f.address)
+		go func(l net.Listener, f portForward) {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					errCh <- err
+					return
+				}
+
+				go forwardConn(ctx, client, c, f)
+			}
+		}(l, f)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
+// forwardConn tunnels the local connection through a port forward stream
+func forwardConn(ctx context.Context, client pty.TerminalClient, c net.Conn, f portForward) {
+	defer func() { _ = c.Close() }()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	addrField := log.String("address", f.network+"://"+f.address)
+	stream, err := client.PortForward(ctx)
+	if err == nil {
+		err = stream.Send(&pty.PortForwardRequest{Network: f.network, Address: f.address})
+	}
+	if err != nil {
+		log.E("start port forward failed", addrField, log.Err(err))
+		return
+	}
+
+	go func() {
+		buf := make([]byte, copyChunkSize)
+		for {
+			n, err := c.Read(buf)
+			if n > 0 {
+				if stream.Send(&pty.PortForwardRequest{Data: buf[:n]}) != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				_ = stream.CloseSend()
+				return
+			}
+		}
+	}()
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				log.E("port forward failed", addrField, log.Err(err))
+			}
+			return
+		}
+
+		if _, err := c.Write(resp.Data); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package ptycli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"arhat.dev/kube-host-pty/pkg/constant"
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+	"arhat.dev/kube-host-pty/pkg/version"
+)
+
+// clientCapabilities are capabilities of pty-client
+var clientCapabilities = []string{pty.CapabilityControlFrames}
+
+// dialOptions report version of pty-client and present the session token,
+// or select the device when connected over tcp, in all calls
+var dialOptions = []grpc.DialOption{
+	grpc.WithUnaryInterceptor(func(
+		ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+	) error {
+		return invoker(withClientMetadata(ctx), method, req, reply, cc, opts...)
+	}),
+	grpc.WithStreamInterceptor(func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		return streamer(withClientMetadata(ctx), desc, cc, method, opts...)
+	}),
+}
+
+func withClientMetadata(ctx context.Context) context.Context {
+	v := version.Version()
+	if v == "" {
+		// the same as dev builds with Makefile
+		v = "none"
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, pty.MetadataKeyClientVersion, v)
+
+	// authorized by client certificate over tcp
+	if opt := clientOptions; opt.Addr != "" {
+		return metadata.AppendToOutgoingContext(ctx,
+			pty.MetadataKeyResourceName, opt.Resource, pty.MetadataKeyDevice, opt.Device)
+	}
+
+	// read every time, the token changes once the session restored after
+	// plugin restart
+	if token, err := pty.ReadTokenFile(tokenFile()); err == nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, pty.MetadataKeySessionToken, token)
+	} else if !os.IsNotExist(err) {
+		log.D("read session token failed", log.Err(err))
+	}
+
+	return ctx
+}
+
+// tokenFile provided by the plugin, or next to the socket for sessions
+// allocated by plugins not providing it
+func tokenFile() string {
+	if file := os.Getenv(constant.EnvironNamePtsTokenFile); file != "" {
+		return file
+	}
+	return os.Getenv(constant.EnvironNamePtsUnixSockFile) + pty.TokenFileSuffix
+}
+
+// requireCapability checks the plugin supports the capability, plugins too
+// old to handshake are assumed to support it, since calls not supported fail
+// with unimplemented error anyway
+func requireCapability(ctx context.Context, conn *grpc.ClientConn, capability string) error {
+	hello, err := pty.NewTerminalClient(conn).Handshake(ctx, pty.NewHello(clientCapabilities))
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		log.D("handshake not supported by plugin")
+		return nil
+	case err != nil:
+		return err
+	}
+
+	log.D("handshake", log.String("plugin_version", hello.GetVersion()),
+		log.String("plugin_commit", hello.GetCommit()), log.Strings("plugin_capabilities", hello.GetCapabilities()))
+	if !hello.HasCapability(capability) {
+		return unsupportedError(hello.GetVersion(), capability)
+	}
+
+	return nil
+}
+
+// unsupported converts unimplemented error of calls to a clear one
+func unsupported(err error, capability string) error {
+	if status.Code(err) == codes.Unimplemented {
+		return unsupportedError("", capability)
+	}
+	return err
+}
+
+func unsupportedError(pluginVersion, capability string) error {
+	if pluginVersion == "" {
+		pluginVersion = "unknown"
+	}
+	return fmt.Errorf("%s is not supported by pty-device-plugin (version %s), please upgrade it", capability, pluginVersion)
+}
@@ -1,5 +1,21 @@
 package ptycli
 
 type Options struct {
-	Socket string `yaml:"sock"`
+	Socket   string `yaml:"sock"`
+	ReadOnly bool   `yaml:"read_only"`
+
+	// Addr of pty-device-plugin serving sessions over tcp, the pts unix
+	// socket of the container is used if empty
+	Addr     string     `yaml:"addr"`
+	Resource string     `yaml:"resource"`
+	Device   string     `yaml:"device"`
+	TLS      TLSOptions `yaml:"tls"`
+}
+
+// TLSOptions to connect to pty-device-plugin over tcp
+type TLSOptions struct {
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
 }
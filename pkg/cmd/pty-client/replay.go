@@ -0,0 +1,252 @@
+package ptycli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"arhat.dev/kube-host-pty/pkg/asciicast"
+)
+
+const (
+	// replaySeekStep is the time to seek with arrow keys
+	replaySeekStep = 5 * time.Second
+
+	// clearScreen resets the terminal before replaying from the start
+	clearScreen = "\x1bc"
+)
+
+type replayOptions struct {
+	speed         float64
+	idleTimeLimit time.Duration
+	start         time.Duration
+	dump          bool
+}
+
+func newReplayCmd(ctx context.Context) *cobra.Command {
+	opt := &replayOptions{}
+	cmd := &cobra.Command{
+		Use:   "replay FILE",
+		Short: "play back a session recording in asciicast v2 format",
+		Long: `play back a session recording in asciicast v2 format recorded by
+pty-device-plugin with real timing, keys when playing:
+
+  space       pause or resume
+  right, l    seek forward 5s
+  left, h     seek backward 5s
+  q, Ctrl-C   quit
+
+  # replay at double speed with idle time capped at 2s
+  pty-client replay --speed 2 --idle-time-limit 2s pts0_default_foo_shell_20190101T000000Z.cast
+  # print text on the screen at the end of session
+  pty-client replay --dump pts0_default_foo_shell_20190101T000000Z.cast`,
+		Args: cobra.ExactArgs(1),
+		// errors are printed by main
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opt.speed <= 0 {
+				return fmt.Errorf("invalid speed %v, must be positive", opt.speed)
+			}
+
+			return runReplay(ctx, args[0], opt)
+		},
+	}
+
+	cmd.Flags().Float64Var(&opt.speed, "speed", 1, "playback speed multiplier")
+	cmd.Flags().DurationVar(&opt.idleTimeLimit, "idle-time-limit", 0, "cap idle time between events to this long, 0 to disable")
+	cmd.Flags().DurationVar(&opt.start, "start", 0, "start playing from this time in the recording")
+	cmd.Flags().BoolVar(&opt.dump, "dump", false, "print text on the screen at the end of the recording instead of playing")
+
+	return cmd
+}
+
+func runReplay(ctx context.Context, file string, opt *replayOptions) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	r, err := asciicast.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	events, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	if opt.dump {
+		screen := asciicast.NewScreen(r.Header.Width, r.Header.Height)
+		for _, e := range events {
+			switch e.Type {
+			case asciicast.EventOutput:
+				screen.Write(e.Data)
+			case asciicast.EventResize:
+				var cols, rows int
+				if _, err := fmt.Sscanf(e.Data, "%dx%d", &cols, &rows); err == nil {
+					screen.Resize(cols, rows)
+				}
+			}
+		}
+
+		_, err := fmt.Println(screen.String())
+		return err
+	}
+
+	p := &player{
+		out:    os.Stdout,
+		events: capIdleTime(events, opt.idleTimeLimit),
+		speed:  opt.speed,
+	}
+
+	keyCh := make(chan byte)
+	if stdin := int(os.Stdin.Fd()); terminal.IsTerminal(stdin) {
+		oldState, err := terminal.MakeRaw(stdin)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = terminal.Restore(stdin, oldState) }()
+
+		go readKeys(os.Stdin, keyCh)
+	}
+
+	p.seek(opt.start)
+	return p.play(ctx, keyCh)
+}
+
+// capIdleTime shortens time between events to limit at most
+func capIdleTime(events []*asciicast.Event, limit time.Duration) []*asciicast.Event {
+	if limit <= 0 {
+		return events
+	}
+
+	result := make([]*asciicast.Event, len(events))
+	last, shift := time.Duration(0), time.Duration(0)
+	for i, e := range events {
+		if idle := e.Time - last; idle > limit {
+			shift += idle - limit
+		}
+		last = e.Time
+
+		capped := *e
+		capped.Time -= shift
+		result[i] = &capped
+	}
+	return result
+}
+
+// readKeys sends keys pressed, arrow keys are translated to h and l
+func readKeys(r io.Reader, keyCh chan<- byte) {
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			close(keyCh)
+			return
+		}
+
+		keys := buf[:n]
+		switch string(keys) {
+		case "\x1b[C", "\x1bOC":
+			keys = []byte{'l'}
+		case "\x1b[D", "\x1bOD":
+			keys = []byte{'h'}
+		}
+
+		for _, k := range keys {
+			keyCh <- k
+		}
+	}
+}
+
+// player plays output events at their time divided by speed
+type player struct {
+	out    io.Writer
+	events []*asciicast.Event
+	speed  float64
+
+	// next is the index of the next event, at is the current time in the
+	// recording
+	next int
+	at   time.Duration
+}
+
+func (p *player) play(ctx context.Context, keyCh <-chan byte) error {
+	paused := false
+	for p.next < len(p.events) {
+		var timer <-chan time.Time
+		if !paused {
+			timer = time.After(time.Duration(float64(p.events[p.next].Time-p.at) / p.speed))
+		}
+
+		started := time.Now()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer:
+			e := p.events[p.next]
+			p.at = e.Time
+			p.next++
+			if err := p.output(e); err != nil {
+				return err
+			}
+		case k, more := <-keyCh:
+			if !more {
+				keyCh = nil
+				continue
+			}
+
+			if !paused {
+				p.at += time.Duration(float64(time.Since(started)) * p.speed)
+			}
+
+			switch k {
+			case ' ':
+				paused = !paused
+			case 'l':
+				p.seek(p.at + replaySeekStep)
+			case 'h':
+				p.seek(p.at - replaySeekStep)
+			case 'q', 0x03:
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// seek to time in the recording, output before is written at once, the
+// screen is cleared and replayed from the start if seeking backward
+func (p *player) seek(to time.Duration) {
+	if to < 0 {
+		to = 0
+	}
+
+	if to < p.at {
+		_, _ = io.WriteString(p.out, clearScreen)
+		p.next = 0
+	}
+
+	for ; p.next < len(p.events) && p.events[p.next].Time <= to; p.next++ {
+		_ = p.output(p.events[p.next])
+	}
+	p.at = to
+}
+
+func (p *player) output(e *asciicast.Event) error {
+	if e.Type != asciicast.EventOutput {
+		return nil
+	}
+
+	_, err := io.WriteString(p.out, e.Data)
+	return err
+}
@@ -2,12 +2,13 @@ package ptydp
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"time"
 
 	"golang.org/x/sys/unix"
-	"google.golang.org/grpc"
 	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
 
 	"arhat.dev/kube-host-pty/pkg/server"
@@ -20,77 +21,262 @@ const (
 )
 
 func NewCmd() (*util.Command, error) {
-	var configFile string
 	opt := &Options{}
 	optFromConfigFile := &Options{}
+	configChangedCh := make(chan *Options, 1)
 
 	cmd := util.DefaultCmd(
-		Name, optFromConfigFile, nil,
+		Name, optFromConfigFile,
+		func(newOpt interface{}) {
+			select {
+			case <-configChangedCh:
+			default:
+			}
+			configChangedCh <- newOpt.(*Options)
+		},
 		func(ctx context.Context, exit context.CancelFunc) error {
+			// config file reloaded is merged with flags the same way
+			optFromFlags := *opt
 			opt.merge(optFromConfigFile)
-			return run(ctx, exit, opt)
+			return run(ctx, exit, opt, &optFromFlags, configChangedCh)
 		},
 	)
 
 	cmd.Flags().StringVarP(&opt.KubeletSocket, "kubelet-unix-sock", "k", k8sDP.KubeletSocket, "kubelet service unix sock listening address")
 	cmd.Flags().StringVarP(&opt.ListenSocket, "plugin-listen-unix-sock", "l", k8sDP.DevicePluginPath+"arhat.sock", "unix sock address to listen")
 	cmd.Flags().StringVarP(&opt.PTSSocketDir, "pts-unix-sock-dir", "d", "/var/run/arhat/pts", "dir to host pts unix sockets")
+	cmd.Flags().StringVar(&opt.PTSSocketMode, "pts-unix-sock-mode", "0600", "octal permission bits of pts unix sockets")
+	cmd.Flags().StringVar(&opt.PTSSocketOwner, "pts-unix-sock-owner", "", "owner of pts unix sockets in form of [user][:group], defaults to the user running this plugin")
 	cmd.Flags().Uint8VarP(&opt.MaxPtyCount, "max-pty", "m", 10, "maximum pty count allowed on this host")
 	cmd.Flags().StringVarP(&opt.Shell, "shell", "s", "sh", "default shell for pty session")
-	cmd.Flags().StringVarP(&configFile, "config", "c", "", "set config file")
+	cmd.Flags().StringVarP(&opt.User, "user", "u", "", "user (name or uid) to run shell as, defaults to the user running this plugin")
+	cmd.Flags().StringVarP(&opt.Group, "group", "g", "", "primary group (name or gid) of shell, defaults to primary group of the user")
+	cmd.Flags().StringSliceVar(&opt.Groups, "groups", nil, "supplementary groups (names or gids) of shell, defaults to all groups of the user")
+	cmd.Flags().BoolVar(&opt.LoginShell, "login-shell", false, "run shell as login shell in home dir of the user")
+	cmd.Flags().DurationVar(&opt.KillGracePeriod, "kill-grace-period", 5*time.Second, "time to wait for session processes to exit after SIGHUP before SIGKILL")
+	cmd.Flags().IntVar(&opt.ScrollbackSize, "scrollback-size", 64*1024, "size in bytes of recent output replayed to clients on attach")
+	cmd.Flags().DurationVar(&opt.IdleTimeout, "idle-timeout", 0, "close sessions without input for this long, 0 to disable")
+	cmd.Flags().StringVar(&opt.MinClientVersion, "min-client-version", "", "reject pty-client older than this version (e.g. v0.2.0), clients of dev builds are always accepted")
+	cmd.Flags().StringVar(&opt.RecordDir, "record-dir", "", "dir to record sessions in asciicast v2 format, empty to disable")
+	cmd.Flags().BoolVar(&opt.RecordInput, "record-input", false, "record input of sessions as well (may contain passwords typed)")
+	cmd.Flags().BoolVar(&opt.AllowAnyPeer, "allow-any-peer", false, "allow any local process to connect to pts unix sockets, by default only processes in the pod the device allocated to are allowed")
+	cmd.Flags().UintSliceVar(&opt.AllowedPeerUIDs, "allowed-peer-uids", nil, "uids of processes allowed to connect to pts unix sockets (e.g. 0,1000), any is allowed if empty")
+	cmd.Flags().UintSliceVar(&opt.AllowedPeerGIDs, "allowed-peer-gids", nil, "primary gids of processes allowed to connect to pts unix sockets, any is allowed if empty")
+	cmd.Flags().IntVar(&opt.RegisterMaxRetry, "register-max-retry", 0, "max retry count of resource registration, 0 means retry until succeeded")
+	cmd.Flags().StringVar(&opt.MetricsListen, "metrics-listen", "", "tcp address to serve prometheus metrics at /metrics (e.g. :9101), empty to disable")
+	cmd.Flags().StringVar(&opt.TCPListen, "tcp-listen", "", "tcp address to serve sessions with mutual tls (e.g. :9443), empty to disable")
+	cmd.Flags().StringVar(&opt.TLS.CAFile, "tls-ca-file", "", "ca certificate to verify client certificates of the tcp listener")
+	cmd.Flags().StringVar(&opt.TLS.CertFile, "tls-cert-file", "", "server certificate of the tcp listener")
+	cmd.Flags().StringVar(&opt.TLS.KeyFile, "tls-key-file", "", "private key of the server certificate")
+	cmd.Flags().StringSliceVar(&opt.AllowedClients, "allowed-clients", nil, "patterns of common name or SANs of client certificates allowed over tcp (e.g. admin,*.ops.example.com), any verified client is allowed if empty")
+	cmd.Flags().StringVar(&opt.PodResourcesSocket, "pod-resources-unix-sock", "/var/lib/kubelet/pod-resources/kubelet.sock", "kubelet pod-resources service unix sock address")
+	cmd.Flags().DurationVar(&opt.GCInterval, "gc-interval", 0, "interval to reclaim sessions of deleted pods via kubelet pod-resources service, disabled by default (0), requires kubelet feature gate KubeletPodResources")
+	cmd.Flags().DurationVar(&opt.GCGracePeriod, "gc-grace-period", time.Minute, "minimum age of sessions to be reclaimed by gc")
+	cmd.Flags().StringVar(&opt.CheckpointFile, "checkpoint-file", "/var/run/arhat/pty-device-plugin.checkpoint", "file to persist allocated sessions across plugin restarts, empty to disable")
+	cmd.Flags().StringSliceVar(&opt.DisabledDevices, "disable-devices", nil, "ids of devices administratively disabled (e.g. pts0,pts1), running sessions of devices disabled at runtime via config file are terminated")
 
 	return cmd, nil
 }
 
-func run(ctx context.Context, exit context.CancelFunc, opt *Options) error {
-	addressField := log.String("addr", opt.ListenSocket)
-	log.D("creating device-plugin service", addressField, log.String("api", k8sDP.Version))
+func run(ctx context.Context, exit context.CancelFunc, opt, optFromFlags *Options, configChangedCh <-chan *Options) error {
+	profiles, err := opt.profiles()
+	if err != nil {
+		return err
+	}
+
+	reconciler := server.NewReconciler(opt.PodResourcesSocket, opt.GCInterval, opt.GCGracePeriod)
+
+	checkpoint := server.NewCheckpoint(opt.CheckpointFile)
+
+	sessionMetrics := server.NewMetrics()
+
+	var remoteServer *server.RemoteServer
+	if opt.TCPListen != "" {
+		if opt.TLS.CAFile == "" || opt.TLS.CertFile == "" || opt.TLS.KeyFile == "" {
+			return fmt.Errorf("tls ca, cert and key files are required to serve sessions over tcp")
+		}
+
+		tlsConfig, err := util.NewServerTLSConfig(opt.TLS.CAFile, opt.TLS.CertFile, opt.TLS.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load tls config failed: %v", err)
+		}
+		remoteServer = server.NewRemoteServer(tlsConfig)
+	}
+
+	var servers []*pluginServer
+	for _, profile := range profiles {
+		log.D("creating device-plugin service",
+			log.String("resource_name", profile.ResourceName),
+			log.String("addr", profile.ListenSocket),
+			log.String("api", k8sDP.Version))
+
+		sessions := server.NewSessionManager(profile.terminalConfig(opt.KillGracePeriod), profile.PTSSocketDir)
+		devicePlugin := server.NewPtyDevicePluginServer(sessions, profile.MaxPtyCount)
+		sessions.SetRecording(profile.RecordDir, *profile.RecordInput)
+		sessions.SetOwnerResolver(server.NewOwnerResolver(profile.ResourceName, opt.PodResourcesSocket, opt.kubeletCheckpointFile()))
+		if !opt.AllowAnyPeer {
+			sessions.SetPeerAuthorization(profile.ResourceName, opt.kubeletCheckpointFile())
+		}
+		sessions.SetAllowedPeers(uint32s(profile.AllowedPeerUIDs), uint32s(profile.AllowedPeerGIDs))
+		devicePlugin.SetDisabledDevices(profile.DisabledDevices)
+		reconciler.Add(profile.ResourceName, sessions)
+		checkpoint.Add(profile.ResourceName, sessions)
+		sessionMetrics.Add(profile.ResourceName, sessions, devicePlugin)
+		if remoteServer != nil {
+			remoteServer.Add(profile.ResourceName, sessions, profile.AllowedClients)
+		}
+
+		servers = append(servers, &pluginServer{
+			resourceName: profile.ResourceName,
+			listenSocket: profile.ListenSocket,
+			sessions:     sessions,
+			plugin:       devicePlugin,
+		})
+	}
 
-	srv := grpc.NewServer([]grpc.ServerOption{}...)
+	// take over sessions before any inherited file closed by util.InitGraceUpgrade
+	if err := checkpoint.TakeOver(ctx); err != nil {
+		log.E("take over sessions from parent process failed", log.Err(err))
+	}
+
+	if opt.CheckpointFile != "" {
+		restoreSessions(ctx, opt, checkpoint)
+	}
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, unix.SIGQUIT)
 	util.Workers.Add(func(func()) (_ interface{}, _ error) {
 		for range sigCh {
-			srv.GracefulStop()
+			for _, ps := range servers {
+				ps.stop(true)
+			}
 			exit()
 			return
 		}
 		return
 	})
 
-	k8sDP.RegisterDevicePluginServer(srv, server.NewPtyDevicePluginServer(opt.Shell, opt.PTSSocketDir, opt.MaxPtyCount))
+	// dump session inventory on SIGUSR1
+	dumpCh := make(chan os.Signal, 1)
+	signal.Notify(dumpCh, unix.SIGUSR1)
 
-	errCh := util.Workers.Add(func(sigContinue func()) (_ interface{}, err error) {
-		log.I("ListenAndServe device-plugin", addressField)
-		defer log.I("ListenAndServe device-plugin exited", addressField)
+	util.Workers.Add(func(func()) (_ interface{}, _ error) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-dumpCh:
+				for _, ps := range servers {
+					log.I("session inventory",
+						log.String("resource_name", ps.resourceName),
+						log.Interface("sessions", ps.sessions.List()))
+				}
+			case optFromConfigFile := <-configChangedCh:
+				newProfiles, err := opt.reloadedProfiles(optFromFlags, optFromConfigFile)
+				if err != nil {
+					log.E("invalid profiles in updated config", log.Err(err))
+					continue
+				}
 
-		if err = util.GRPCListenAndServe(srv, "unix", opt.ListenSocket); err != nil {
-			log.E("ListenAndServe device-plugin failed", addressField)
+				for _, profile := range newProfiles {
+					for _, ps := range servers {
+						if ps.resourceName == profile.ResourceName {
+							ps.plugin.SetDisabledDevices(profile.DisabledDevices)
+						}
+					}
+				}
+			}
 		}
-		return
-	})[0].Error
+	})
 
-	select {
-	case err := <-errCh:
-		return err
-	default:
-		// continue
+	for _, ps := range servers {
+		if err := ps.serve(ctx); err != nil {
+			return err
+		}
 	}
 
-	conn, err := util.DialGRPC(ctx, "unix", opt.ListenSocket, 5*time.Second, nil)
-	if err != nil {
-		log.E("dial device-plugin service failed", log.Err(err))
-		return err
-	} else {
-		_ = conn.Close()
+	var metricsServer *http.Server
+	if opt.MetricsListen != "" {
+		metricsServer = serveMetrics(opt.MetricsListen, sessionMetrics)
 	}
 
+	if remoteServer != nil {
+		addressField := log.String("addr", opt.TCPListen)
+		util.Workers.Add(func(func()) (_ interface{}, err error) {
+			log.I("ListenAndServe sessions over tcp", addressField)
+			defer log.I("ListenAndServe sessions over tcp exited", addressField)
+
+			if err = remoteServer.ListenAndServe(opt.TCPListen); err != nil {
+				log.E("ListenAndServe sessions over tcp failed", addressField, log.Err(err))
+			}
+			return
+		})
+	}
+
+	// watch before register, so we won't miss any kubelet restart
+	kubeletEvents, watchErr := util.WatchFileCreateRemove(opt.KubeletSocket)
+	for _, ps := range servers {
+		if watchErr != nil {
+			break
+		}
+		ps.events, watchErr = util.WatchFileCreateRemove(ps.listenSocket)
+	}
+
+	if watchErr != nil {
+		log.E("watch kubelet socket failed, kubelet restart won't be handled", log.Err(watchErr))
+	}
+
+	// hand sessions over to the new process, users attached will be
+	// disconnected from this process and can attach again to the new one
+	util.BeforeGraceUpgrade(checkpoint.Handoff)
+	util.AfterGraceUpgrade(func() {
+		for _, ps := range servers {
+			ps.stop(false)
+		}
+		if metricsServer != nil {
+			_ = metricsServer.Close()
+		}
+		if remoteServer != nil {
+			remoteServer.Stop()
+		}
+		checkpoint.Release()
+	})
 	util.InitGraceUpgrade(exit, 30*time.Second, unix.SIGHUP)
 
-	if err := opt.registerResource(ctx); err != nil {
-		return err
+	for _, ps := range servers {
+		if err := opt.registerResourceWithRetry(ctx, ps.resourceName, ps.listenSocket); err != nil {
+			return err
+		}
+	}
+
+	if watchErr == nil {
+		util.Workers.Add(func(func()) (_ interface{}, _ error) {
+			handleKubeletRestart(ctx, opt, servers, kubeletEvents)
+			return
+		})
+	}
+
+	if opt.GCInterval > 0 {
+		util.Workers.Add(func(func()) (_ interface{}, _ error) {
+			reconciler.Run(ctx)
+			return
+		})
 	}
 
 	return nil
 }
+
+// restoreSessions of previous plugin process according to allocations
+// recorded by kubelet, kubelet won't call Allocate again for running pods
+func restoreSessions(ctx context.Context, opt *Options, checkpoint *server.Checkpoint) {
+	allocated, err := server.LoadKubeletAllocations(opt.kubeletCheckpointFile())
+	if err != nil {
+		// still clean up previous sessions
+		log.E("load kubelet checkpoint failed, sessions won't be restored", log.Err(err))
+		allocated = nil
+	}
+
+	if err := checkpoint.Restore(ctx, allocated); err != nil {
+		log.E("restore sessions failed", log.String("file", opt.CheckpointFile), log.Err(err))
+	}
+}
@@ -0,0 +1,40 @@
+package ptydp
+
+import (
+	"net/http"
+
+	"arhat.dev/kube-host-pty/pkg/metrics"
+	"arhat.dev/kube-host-pty/pkg/server"
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+var (
+	registrationAttempts = metrics.NewCounterVec("pty_registration_attempts_total",
+		"Attempts to register resources to kubelet.", "resource_name", "result")
+	kubeletReconnects = metrics.NewCounterVec("pty_kubelet_reconnects_total",
+		"Resources registered again after kubelet restarted.", "resource_name")
+)
+
+// serveMetrics serves metrics of the plugin and sessions at `/metrics`
+func serveMetrics(address string, sessionMetrics *server.Metrics) *http.Server {
+	registry := metrics.NewRegistry()
+	registry.Register(sessionMetrics, registrationAttempts, kubeletReconnects)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	srv := &http.Server{Addr: address, Handler: mux}
+
+	addressField := log.String("addr", address)
+	util.Workers.Add(func(func()) (_ interface{}, err error) {
+		log.I("ListenAndServe metrics", addressField)
+		defer log.I("ListenAndServe metrics exited", addressField)
+
+		if err = util.HTTPListenAndServe(srv, address); err != nil && err != http.ErrServerClosed {
+			log.E("ListenAndServe metrics failed", addressField, log.Err(err))
+		}
+		return
+	})
+
+	return srv
+}
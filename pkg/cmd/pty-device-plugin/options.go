@@ -2,25 +2,308 @@ package ptydp
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
 
 	"arhat.dev/kube-host-pty/pkg/constant"
+	"arhat.dev/kube-host-pty/pkg/pty"
 	"arhat.dev/kube-host-pty/pkg/util"
 	"arhat.dev/kube-host-pty/pkg/util/log"
 )
 
 type Options struct {
-	KubeletSocket string `yaml:"kubelet_socket"`
-	ListenSocket  string `yaml:"listen_socket"`
-	PTSSocketDir  string `yaml:"pts_socket_dir"`
-	MaxPtyCount   uint8  `yaml:"max_pty"`
-	Shell         string `yaml:"shell"`
+	KubeletSocket  string `yaml:"kubelet_socket"`
+	ListenSocket   string `yaml:"listen_socket"`
+	PTSSocketDir   string `yaml:"pts_socket_dir"`
+	PTSSocketMode  string `yaml:"pts_socket_mode"`
+	PTSSocketOwner string `yaml:"pts_socket_owner"`
+	MaxPtyCount    uint8  `yaml:"max_pty"`
+	Shell          string `yaml:"shell"`
+
+	User       string   `yaml:"user"`
+	Group      string   `yaml:"group"`
+	Groups     []string `yaml:"groups"`
+	LoginShell bool     `yaml:"login_shell"`
+
+	KillGracePeriod time.Duration `yaml:"kill_grace_period"`
+	ScrollbackSize  int           `yaml:"scrollback_size"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+
+	// MinClientVersion rejects pty-client older than this version
+	MinClientVersion string `yaml:"min_client_version"`
+
+	// AllowAnyPeer allows any local process to connect to pts unix sockets,
+	// otherwise only processes in the pod the device allocated to
+	AllowAnyPeer bool `yaml:"allow_any_peer"`
+	// AllowedPeerUIDs and AllowedPeerGIDs restrict uid and primary gid of
+	// processes connecting to pts unix sockets, any is allowed if empty
+	AllowedPeerUIDs []uint `yaml:"allowed_peer_uids"`
+	AllowedPeerGIDs []uint `yaml:"allowed_peer_gids"`
+
+	// RecordDir to record sessions in asciicast v2 format, empty to disable
+	RecordDir   string `yaml:"record_dir"`
+	RecordInput bool   `yaml:"record_input"`
+
+	RegisterMaxRetry int `yaml:"register_max_retry"`
+
+	// MetricsListen is the tcp address to serve prometheus metrics at
+	// `/metrics`, empty to disable
+	MetricsListen string `yaml:"metrics_listen"`
+
+	// TCPListen is the tcp address to serve sessions with mutual tls, for
+	// clients unable to access pts unix sockets, empty to disable
+	TCPListen string     `yaml:"tcp_listen"`
+	TLS       TLSOptions `yaml:"tls"`
+	// AllowedClients are patterns of common name or SANs of client
+	// certificates allowed to access sessions over tcp, any client with
+	// certificate signed by the ca is allowed if empty
+	AllowedClients []string `yaml:"allowed_clients"`
+
+	// PodResourcesSocket of kubelet, used to find sessions of deleted pods
+	PodResourcesSocket string        `yaml:"pod_resources_socket"`
+	GCInterval         time.Duration `yaml:"gc_interval"`
+	GCGracePeriod      time.Duration `yaml:"gc_grace_period"`
+
+	// CheckpointFile to persist allocated sessions, sessions still allocated
+	// are restored after plugin restart, empty to disable
+	CheckpointFile string `yaml:"checkpoint_file"`
+
+	// DisabledDevices only applies to the default profile, set disabled
+	// devices in each profile when profiles provided
+	DisabledDevices []string `yaml:"disabled_devices"`
+
+	// Profiles of pty resources, options above are used as default values
+	// of profiles, if no profile provided, only resource `arhat.dev/pty` will
+	// be served
+	Profiles []ProfileOptions `yaml:"profiles"`
+}
+
+// TLSOptions of the tcp listener, client certificates are verified with
+// the ca
+type TLSOptions struct {
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// ProfileOptions defines a kind of pty resource
+type ProfileOptions struct {
+	// ResourceName to register, e.g. `arhat.dev/pty-admin`
+	ResourceName string `yaml:"resource_name"`
+	// ListenSocket of the device plugin endpoint, derived from resource name
+	// in device plugin dir if empty
+	ListenSocket string `yaml:"listen_socket"`
+	// PTSSocketDir to host pts unix sockets, derived from resource name in
+	// `pts_socket_dir` if empty
+	PTSSocketDir   string `yaml:"pts_socket_dir"`
+	PTSSocketMode  string `yaml:"pts_socket_mode"`
+	PTSSocketOwner string `yaml:"pts_socket_owner"`
+	MaxPtyCount    uint8  `yaml:"max_pty"`
+	Shell          string `yaml:"shell"`
+
+	User       string   `yaml:"user"`
+	Group      string   `yaml:"group"`
+	Groups     []string `yaml:"groups"`
+	LoginShell *bool    `yaml:"login_shell"`
+
+	Env            map[string]string `yaml:"env"`
+	Limits         pty.Limits        `yaml:"limits"`
+	ScrollbackSize int               `yaml:"scrollback_size"`
+	IdleTimeout    time.Duration     `yaml:"idle_timeout"`
+
+	MinClientVersion string `yaml:"min_client_version"`
+
+	// RecordDir to record sessions, derived from resource name in
+	// `record_dir` if empty
+	RecordDir   string `yaml:"record_dir"`
+	RecordInput *bool  `yaml:"record_input"`
+
+	AllowedPeerUIDs []uint   `yaml:"allowed_peer_uids"`
+	AllowedPeerGIDs []uint   `yaml:"allowed_peer_gids"`
+	AllowedClients  []string `yaml:"allowed_clients"`
+
+	DisabledDevices []string `yaml:"disabled_devices"`
+}
+
+// terminalConfig of sessions of this profile
+func (p *ProfileOptions) terminalConfig(killGracePeriod time.Duration) pty.Config {
+	return pty.Config{
+		Shell:           p.Shell,
+		User:            p.User,
+		Group:           p.Group,
+		Groups:          p.Groups,
+		LoginShell:      p.LoginShell != nil && *p.LoginShell,
+		Env:             p.Env,
+		Limits:          p.Limits,
+		KillGracePeriod: killGracePeriod,
+		ScrollbackSize:  p.ScrollbackSize,
+		IdleTimeout:     p.IdleTimeout,
+
+		MinClientVersion: p.MinClientVersion,
+
+		// validated in profiles
+		SocketMode:  parseSocketMode(p.PTSSocketMode),
+		SocketOwner: p.PTSSocketOwner,
+	}
+}
+
+// uint32s converts ids to type of peer credentials
+func uint32s(ids []uint) []uint32 {
+	if ids == nil {
+		return nil
+	}
+
+	result := make([]uint32, len(ids))
+	for i, id := range ids {
+		result[i] = uint32(id)
+	}
+	return result
+}
+
+func parseSocketMode(mode string) os.FileMode {
+	m, _ := strconv.ParseUint(mode, 8, 32)
+	return os.FileMode(m)
 }
 
-func (o Options) registerResource(ctx context.Context) error {
+// profiles returns all profiles with default values filled
+func (o *Options) profiles() ([]ProfileOptions, error) {
+	profiles := o.Profiles
+	if len(profiles) == 0 {
+		profiles = []ProfileOptions{{
+			ResourceName:    constant.ResourceNamePty,
+			ListenSocket:    o.ListenSocket,
+			PTSSocketDir:    o.PTSSocketDir,
+			DisabledDevices: o.DisabledDevices,
+		}}
+	}
+
+	seen := make(map[string]bool)
+	result := make([]ProfileOptions, len(profiles))
+	for i, p := range profiles {
+		if !strings.Contains(p.ResourceName, "/") {
+			return nil, fmt.Errorf("invalid resource name %q of profile %d, must be in form of `domain/name`", p.ResourceName, i)
+		}
+
+		if seen[p.ResourceName] {
+			return nil, fmt.Errorf("duplicate profile of resource %q", p.ResourceName)
+		}
+		seen[p.ResourceName] = true
+
+		// resource name `arhat.dev/pty-admin` is hosted at `arhat.dev_pty-admin`
+		name := strings.Replace(p.ResourceName, "/", "_", -1)
+
+		if p.ListenSocket == "" {
+			p.ListenSocket = filepath.Join(filepath.Dir(o.ListenSocket), name+".sock")
+		}
+
+		if p.PTSSocketDir == "" {
+			p.PTSSocketDir = filepath.Join(o.PTSSocketDir, name)
+		}
+
+		if p.PTSSocketMode == "" {
+			p.PTSSocketMode = o.PTSSocketMode
+		}
+
+		if m, err := strconv.ParseUint(p.PTSSocketMode, 8, 32); p.PTSSocketMode != "" && (err != nil || m&^0777 != 0) {
+			return nil, fmt.Errorf("invalid pts socket mode %q of profile %d, must be octal permission bits", p.PTSSocketMode, i)
+		}
+
+		if p.PTSSocketOwner == "" {
+			p.PTSSocketOwner = o.PTSSocketOwner
+		}
+
+		if p.MaxPtyCount == 0 {
+			p.MaxPtyCount = o.MaxPtyCount
+		}
+
+		if p.Shell == "" {
+			p.Shell = o.Shell
+		}
+
+		if p.User == "" {
+			p.User = o.User
+		}
+
+		if p.Group == "" {
+			p.Group = o.Group
+		}
+
+		if p.Groups == nil {
+			p.Groups = o.Groups
+		}
+
+		if p.ScrollbackSize == 0 {
+			p.ScrollbackSize = o.ScrollbackSize
+		}
+
+		if p.ScrollbackSize < 0 {
+			return nil, fmt.Errorf("invalid scrollback size %d of profile %d, must not be negative", p.ScrollbackSize, i)
+		}
+
+		if p.IdleTimeout == 0 {
+			p.IdleTimeout = o.IdleTimeout
+		}
+
+		if p.MinClientVersion == "" {
+			p.MinClientVersion = o.MinClientVersion
+		}
+
+		if p.RecordDir == "" && o.RecordDir != "" {
+			p.RecordDir = filepath.Join(o.RecordDir, name)
+		}
+
+		if p.RecordInput == nil {
+			recordInput := o.RecordInput
+			p.RecordInput = &recordInput
+		}
+
+		if p.AllowedPeerUIDs == nil {
+			p.AllowedPeerUIDs = o.AllowedPeerUIDs
+		}
+
+		if p.AllowedPeerGIDs == nil {
+			p.AllowedPeerGIDs = o.AllowedPeerGIDs
+		}
+
+		if p.AllowedClients == nil {
+			p.AllowedClients = o.AllowedClients
+		}
+
+		if p.LoginShell == nil {
+			loginShell := o.LoginShell
+			p.LoginShell = &loginShell
+		}
+
+		result[i] = p
+	}
+
+	return result, nil
+}
+
+// reloadedProfiles returns profiles of config file reloaded merged with
+// flags, only device status can be changed at runtime, so sockets in use are
+// kept
+func (o *Options) reloadedProfiles(optFromFlags, optFromConfigFile *Options) ([]ProfileOptions, error) {
+	newOpt := *optFromFlags
+	newOpt.merge(optFromConfigFile)
+	newOpt.ListenSocket, newOpt.PTSSocketDir = o.ListenSocket, o.PTSSocketDir
+
+	return newOpt.profiles()
+}
+
+// kubeletCheckpointFile is the device manager checkpoint of kubelet, which
+// lives along with the kubelet socket
+func (o *Options) kubeletCheckpointFile() string {
+	return filepath.Join(filepath.Dir(o.KubeletSocket), "kubelet_internal_checkpoint")
+}
+
+func (o Options) registerResource(ctx context.Context, resourceName, listenSocket string) error {
 	clientConn, err := util.DialGRPC(ctx, "unix", o.KubeletSocket, 5*time.Second, nil)
 	if err != nil {
 		return err
@@ -28,17 +311,17 @@ func (o Options) registerResource(ctx context.Context) error {
 	defer func() { _ = clientConn.Close() }()
 
 	client := k8sDP.NewRegistrationClient(clientConn)
-	endpoint := filepath.Base(o.ListenSocket)
+	endpoint := filepath.Base(listenSocket)
 
 	log.D("start register resource",
-		log.String("resource_name", constant.ResourceNamePty),
+		log.String("resource_name", resourceName),
 		log.String("api_version", k8sDP.Version),
 		log.String("endpoint", endpoint))
 
 	if _, err = client.Register(ctx, &k8sDP.RegisterRequest{
 		Version:      k8sDP.Version,
 		Endpoint:     endpoint,
-		ResourceName: constant.ResourceNamePty,
+		ResourceName: resourceName,
 	}); err != nil {
 		log.E("register resource failed", log.Err(err))
 		return err
@@ -47,6 +330,20 @@ func (o Options) registerResource(ctx context.Context) error {
 	return nil
 }
 
+// registerResourceWithRetry registers resource with exponential backoff,
+// kubelet may not be ready to accept registration right after restart
+func (o Options) registerResourceWithRetry(ctx context.Context, resourceName, listenSocket string) error {
+	return util.RetryWithBackoff(ctx, time.Second, 30*time.Second, o.RegisterMaxRetry, func() error {
+		err := o.registerResource(ctx, resourceName, listenSocket)
+		if err != nil {
+			registrationAttempts.Inc(resourceName, "failure")
+		} else {
+			registrationAttempts.Inc(resourceName, "success")
+		}
+		return err
+	})
+}
+
 func (o *Options) merge(a *Options) {
 	if a == nil {
 		return
@@ -59,4 +356,128 @@ func (o *Options) merge(a *Options) {
 	if a.ListenSocket != "" {
 		o.ListenSocket = a.ListenSocket
 	}
+
+	if a.PTSSocketDir != "" {
+		o.PTSSocketDir = a.PTSSocketDir
+	}
+
+	if a.PTSSocketMode != "" {
+		o.PTSSocketMode = a.PTSSocketMode
+	}
+
+	if a.PTSSocketOwner != "" {
+		o.PTSSocketOwner = a.PTSSocketOwner
+	}
+
+	if a.MaxPtyCount != 0 {
+		o.MaxPtyCount = a.MaxPtyCount
+	}
+
+	if a.Shell != "" {
+		o.Shell = a.Shell
+	}
+
+	if a.User != "" {
+		o.User = a.User
+	}
+
+	if a.Group != "" {
+		o.Group = a.Group
+	}
+
+	if a.Groups != nil {
+		o.Groups = a.Groups
+	}
+
+	if a.LoginShell {
+		o.LoginShell = a.LoginShell
+	}
+
+	if a.KillGracePeriod != 0 {
+		o.KillGracePeriod = a.KillGracePeriod
+	}
+
+	if a.ScrollbackSize != 0 {
+		o.ScrollbackSize = a.ScrollbackSize
+	}
+
+	if a.IdleTimeout != 0 {
+		o.IdleTimeout = a.IdleTimeout
+	}
+
+	if a.MinClientVersion != "" {
+		o.MinClientVersion = a.MinClientVersion
+	}
+
+	if a.AllowAnyPeer {
+		o.AllowAnyPeer = a.AllowAnyPeer
+	}
+
+	if a.AllowedPeerUIDs != nil {
+		o.AllowedPeerUIDs = a.AllowedPeerUIDs
+	}
+
+	if a.AllowedPeerGIDs != nil {
+		o.AllowedPeerGIDs = a.AllowedPeerGIDs
+	}
+
+	if a.RecordDir != "" {
+		o.RecordDir = a.RecordDir
+	}
+
+	if a.RecordInput {
+		o.RecordInput = a.RecordInput
+	}
+
+	if a.RegisterMaxRetry != 0 {
+		o.RegisterMaxRetry = a.RegisterMaxRetry
+	}
+
+	if a.MetricsListen != "" {
+		o.MetricsListen = a.MetricsListen
+	}
+
+	if a.TCPListen != "" {
+		o.TCPListen = a.TCPListen
+	}
+
+	if a.TLS.CAFile != "" {
+		o.TLS.CAFile = a.TLS.CAFile
+	}
+
+	if a.TLS.CertFile != "" {
+		o.TLS.CertFile = a.TLS.CertFile
+	}
+
+	if a.TLS.KeyFile != "" {
+		o.TLS.KeyFile = a.TLS.KeyFile
+	}
+
+	if a.AllowedClients != nil {
+		o.AllowedClients = a.AllowedClients
+	}
+
+	if a.PodResourcesSocket != "" {
+		o.PodResourcesSocket = a.PodResourcesSocket
+	}
+
+	if a.GCInterval != 0 {
+		o.GCInterval = a.GCInterval
+	}
+
+	if a.GCGracePeriod != 0 {
+		o.GCGracePeriod = a.GCGracePeriod
+	}
+
+	if a.CheckpointFile != "" {
+		o.CheckpointFile = a.CheckpointFile
+	}
+
+	if a.DisabledDevices != nil {
+		o.DisabledDevices = a.DisabledDevices
+	}
+
+	if a.Profiles != nil {
+		o.Profiles = a.Profiles
+	}
 }
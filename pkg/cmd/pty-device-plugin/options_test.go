@@ -0,0 +1,130 @@
+package ptydp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"arhat.dev/kube-host-pty/pkg/util"
+)
+
+func TestProfilesInvalidScrollbackSize(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		opt  Options
+	}{
+		{"default profile", Options{ScrollbackSize: -1}},
+		{"profile", Options{Profiles: []ProfileOptions{{ResourceName: "arhat.dev/pty-admin", ScrollbackSize: -1}}}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := c.opt.profiles()
+			if err == nil || !strings.Contains(err.Error(), "scrollback size") {
+				t.Errorf("expected invalid scrollback size error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProfilesInheritScrollbackSize(t *testing.T) {
+	opt := Options{
+		ScrollbackSize: 1024,
+		Profiles: []ProfileOptions{
+			{ResourceName: "arhat.dev/pty-admin"},
+			{ResourceName: "arhat.dev/pty-ops", ScrollbackSize: 2048},
+		},
+	}
+
+	profiles, err := opt.profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []int{1024, 2048} {
+		if profiles[i].ScrollbackSize != expected {
+			t.Errorf("expected scrollback size %d of profile %d, got %d", expected, i, profiles[i].ScrollbackSize)
+		}
+	}
+}
+
+func TestReloadedProfilesKeepFlags(t *testing.T) {
+	optFromFlags := &Options{ListenSocket: "/dp/arhat.sock", PTSSocketDir: "/pts", DisabledDevices: []string{"pts1"}}
+	opt := *optFromFlags
+
+	for _, c := range []struct {
+		name              string
+		optFromConfigFile *Options
+		expected          []string
+	}{
+		{"not set in file", &Options{Shell: "bash"}, []string{"pts1"}},
+		{"set in file", &Options{DisabledDevices: []string{"pts2"}}, []string{"pts2"}},
+		{"enabled in file", &Options{DisabledDevices: []string{}}, []string{}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			profiles, err := opt.reloadedProfiles(optFromFlags, c.optFromConfigFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := profiles[0].DisabledDevices; strings.Join(actual, ",") != strings.Join(c.expected, ",") {
+				t.Errorf("expected disabled devices %v, got %v", c.expected, actual)
+			}
+		})
+	}
+
+	if len(optFromFlags.DisabledDevices) != 1 {
+		t.Errorf("options from flags modified: %v", optFromFlags.DisabledDevices)
+	}
+}
+
+func TestConfigReloadEnablesDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ptydp-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(file, []byte("shell: sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	optFromFlags := &Options{ListenSocket: "/dp/arhat.sock", PTSSocketDir: "/pts"}
+	opt := *optFromFlags
+	ch := util.NotifyWhenConfigChanged(file, func() interface{} { return &Options{} }, yaml.Unmarshal)
+
+	// waits for profiles with disabled devices expected
+	reload := func(content string, expected []string) {
+		t.Helper()
+
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var actual []string
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case v := <-ch:
+				profiles, err := opt.reloadedProfiles(optFromFlags, v.(*Options))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if actual = profiles[0].DisabledDevices; strings.Join(actual, ",") == strings.Join(expected, ",") {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("expected disabled devices %v, got %v", expected, actual)
+			}
+		}
+	}
+
+	reload("shell: sh\ndisabled_devices: [pts0]\n", []string{"pts0"})
+	// key removed from the file
+	reload("shell: sh\n", nil)
+}
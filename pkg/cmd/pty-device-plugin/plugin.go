@@ -0,0 +1,165 @@
+package ptydp
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
+
+	"arhat.dev/kube-host-pty/pkg/server"
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+const (
+	// wait for more events after kubelet restart detected, kubelet will
+	// remove our socket and create its own, we only handle them once
+	kubeletRestartSettleTime = time.Second
+)
+
+// pluginServer manages the grpc server of device-plugin service of a
+// profile, the server needs to be recreated once kubelet cleaned up the
+// device plugin dir
+type pluginServer struct {
+	resourceName string
+	listenSocket string
+	sessions     *server.SessionManager
+	plugin       server.PtyDevicePluginServer
+	events       *util.FileEventChan
+
+	srv *grpc.Server
+	mu  sync.Mutex
+}
+
+// serve starts a new grpc server listening at the plugin socket and waits
+// until it's reachable
+func (s *pluginServer) serve(ctx context.Context) error {
+	addressField := log.String("addr", s.listenSocket)
+
+	srv := grpc.NewServer([]grpc.ServerOption{}...)
+	k8sDP.RegisterDevicePluginServer(srv, s.plugin)
+
+	s.mu.Lock()
+	s.srv = srv
+	s.mu.Unlock()
+
+	errCh := util.Workers.Add(func(sigContinue func()) (_ interface{}, err error) {
+		log.I("ListenAndServe device-plugin", addressField)
+		defer log.I("ListenAndServe device-plugin exited", addressField)
+
+		if err = util.GRPCListenAndServe(srv, "unix", s.listenSocket); err != nil {
+			log.E("ListenAndServe device-plugin failed", addressField, log.Err(err))
+		}
+		return
+	})[0].Error
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		// continue
+	}
+
+	conn, err := util.DialGRPC(ctx, "unix", s.listenSocket, 5*time.Second, nil)
+	if err != nil {
+		log.E("dial device-plugin service failed", log.Err(err))
+		return err
+	}
+	_ = conn.Close()
+
+	return nil
+}
+
+func (s *pluginServer) stop(graceful bool) {
+	s.mu.Lock()
+	srv := s.srv
+	s.srv = nil
+	s.mu.Unlock()
+
+	if srv == nil {
+		return
+	}
+
+	if graceful {
+		srv.GracefulStop()
+	} else {
+		srv.Stop()
+	}
+}
+
+// restart stops current grpc server and serves at a newly created socket
+func (s *pluginServer) restart(ctx context.Context) error {
+	// ListAndWatch streams are long running, do not wait for them
+	s.stop(false)
+	return s.serve(ctx)
+}
+
+// handleKubeletRestart recreates plugin sockets and registers resources
+// again when kubelet restarted or any of our sockets got deleted
+func handleKubeletRestart(ctx context.Context, opt *Options, servers []*pluginServer, kubeletEvents *util.FileEventChan) {
+	socketRemovedCh := make(chan struct{}, 1)
+	for _, ps := range servers {
+		ps := ps
+		util.Workers.Add(func(func()) (_ interface{}, _ error) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ps.events.Remove:
+					log.I("device-plugin socket removed", log.String("addr", ps.listenSocket))
+					select {
+					case socketRemovedCh <- struct{}{}:
+					default:
+					}
+				}
+			}
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-kubeletEvents.Create:
+			log.I("kubelet socket created, kubelet may have restarted", log.String("addr", opt.KubeletSocket))
+		case <-socketRemovedCh:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(kubeletRestartSettleTime):
+			drainEvents(kubeletEvents.Create, socketRemovedCh)
+		}
+
+		for _, ps := range servers {
+			if _, err := os.Stat(ps.listenSocket); os.IsNotExist(err) {
+				err = util.RetryWithBackoff(ctx, time.Second, 30*time.Second, opt.RegisterMaxRetry, func() error {
+					return ps.restart(ctx)
+				})
+				if err != nil {
+					log.E("recreate device-plugin socket failed", log.String("addr", ps.listenSocket), log.Err(err))
+					continue
+				}
+			}
+
+			if err := opt.registerResourceWithRetry(ctx, ps.resourceName, ps.listenSocket); err != nil {
+				log.E("register resource again failed", log.String("resource_name", ps.resourceName), log.Err(err))
+				continue
+			}
+			kubeletReconnects.Inc(ps.resourceName)
+		}
+	}
+}
+
+func drainEvents(chs ...chan struct{}) {
+	for _, ch := range chs {
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
@@ -6,4 +6,5 @@ const (
 
 const (
 	EnvironNamePtsUnixSockFile = "KUBE_HOST_PTY_SOCK"
+	EnvironNamePtsTokenFile    = "KUBE_HOST_PTY_TOKEN_FILE"
 )
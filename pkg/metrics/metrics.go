@@ -0,0 +1,281 @@
+// Package metrics implements metrics exposed in prometheus text format, see
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Collector writes metrics when scraped
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Registry serves metrics of all collectors registered
+type Registry struct {
+	collectors []Collector
+	mu         sync.RWMutex
+}
+
+// Register adds collectors to the registry
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, collectors...)
+	r.mu.Unlock()
+}
+
+// Write writes metrics of all collectors in text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.RLock()
+	collectors := r.collectors
+	r.mu.RUnlock()
+
+	mw := &Writer{w: bufio.NewWriter(w)}
+	for _, c := range collectors {
+		c.Collect(mw)
+	}
+	return mw.w.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = r.Write(w)
+}
+
+// Writer writes metric families and their samples
+type Writer struct {
+	w *bufio.Writer
+}
+
+// Family starts a metric family, samples of it should be written right after
+func (w *Writer) Family(name, help, typ string) {
+	_, _ = w.w.WriteString("# HELP " + name + " " + escape(help, false) + "\n")
+	_, _ = w.w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// Sample writes a sample with labels, label names and values are paired
+func (w *Writer) Sample(name string, labelNames, labelValues []string, value float64) {
+	_, _ = w.w.WriteString(name)
+	if len(labelNames) > 0 {
+		_ = w.w.WriteByte('{')
+		for i, n := range labelNames {
+			if i > 0 {
+				_ = w.w.WriteByte(',')
+			}
+			_, _ = w.w.WriteString(n + `="` + escape(labelValues[i], true) + `"`)
+		}
+		_ = w.w.WriteByte('}')
+	}
+	_, _ = w.w.WriteString(" " + formatValue(value) + "\n")
+}
+
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// NewCounterVec creates counters partitioned by label values
+func NewCounterVec(name, help string, labelNames ...string) *Vec {
+	return newVec(name, help, TypeCounter, labelNames)
+}
+
+// NewGaugeVec creates gauges partitioned by label values
+func NewGaugeVec(name, help string, labelNames ...string) *Vec {
+	return newVec(name, help, TypeGauge, labelNames)
+}
+
+func newVec(name, help, typ string, labelNames []string) *Vec {
+	return &Vec{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		values:     make(map[string]*sample),
+	}
+}
+
+// Vec is a counter or gauge partitioned by label values
+type Vec struct {
+	name, help, typ string
+	labelNames      []string
+
+	values map[string]*sample
+	mu     sync.Mutex
+}
+
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// Inc adds 1 to the value of the label values
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Add delta to the value of the label values
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	v.mu.Lock()
+	v.get(labelValues).value += delta
+	v.mu.Unlock()
+}
+
+// Set the value of the label values
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.mu.Lock()
+	v.get(labelValues).value = value
+	v.mu.Unlock()
+}
+
+func (v *Vec) get(labelValues []string) *sample {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.values[key]
+	if !ok {
+		s = &sample{labelValues: append([]string(nil), labelValues...)}
+		v.values[key] = s
+	}
+	return s
+}
+
+func (v *Vec) Collect(w *Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.Family(v.name, v.help, v.typ)
+	for _, key := range keys {
+		s := v.values[key]
+		w.Sample(v.name, v.labelNames, s.labelValues, s.value)
+	}
+}
+
+// NewHistogramVec creates histograms with upper bounds of buckets sorted,
+// partitioned by label values
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{
+		name:       name,
+		help:       help,
+		buckets:    buckets,
+		labelNames: labelNames,
+		values:     make(map[string]*histogram),
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	name, help string
+	buckets    []float64
+	labelNames []string
+
+	values map[string]*histogram
+	mu     sync.Mutex
+}
+
+type histogram struct {
+	labelValues []string
+	// counts of observations in each bucket, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds an observation to the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogram{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = s
+	}
+
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) Collect(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.Family(h.name, h.help, TypeHistogram)
+	labelNames := append(append([]string(nil), h.labelNames...), "le")
+	for _, key := range keys {
+		s := h.values[key]
+		labelValues := append(append([]string(nil), s.labelValues...), "")
+
+		cumulative := uint64(0)
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			labelValues[len(labelValues)-1] = formatValue(upper)
+			w.Sample(h.name+"_bucket", labelNames, labelValues, float64(cumulative))
+		}
+		labelValues[len(labelValues)-1] = "+Inf"
+		w.Sample(h.name+"_bucket", labelNames, labelValues, float64(s.count))
+
+		w.Sample(h.name+"_sum", h.labelNames, s.labelValues, s.sum)
+		w.Sample(h.name+"_count", h.labelNames, s.labelValues, float64(s.count))
+	}
+}
+
+// CollectorFunc collects metrics with the function
+type CollectorFunc func(w *Writer)
+
+func (f CollectorFunc) Collect(w *Writer) {
+	f(w)
+}
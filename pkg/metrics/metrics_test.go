@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	counter := NewCounterVec("pty_sessions_total", "Sessions started.", "device")
+	counter.Inc("pts1")
+	counter.Add(2, "pts0")
+	counter.Inc("pts1")
+
+	gauge := NewGaugeVec("pty_clients", "Clients attached.\nPer \\ device.", "device", "profile")
+	gauge.Set(3, "pts0", `a "quoted"`+"\n"+`\ value`)
+
+	histogram := NewHistogramVec("pty_attach_seconds", "Attach duration.", []float64{0.5, 1, 10}, "device")
+	for _, v := range []float64{0.1, 0.5, 0.7, 5, 20} {
+		histogram.Observe(v, "pts0")
+	}
+
+	r := NewRegistry()
+	r.Register(counter, gauge, histogram, CollectorFunc(func(w *Writer) {
+		w.Family("pty_up", "Whether the plugin is up.", TypeGauge)
+		w.Sample("pty_up", nil, nil, 1)
+		w.Sample("pty_inf", nil, nil, math.Inf(1))
+		w.Sample("pty_inf", nil, nil, math.Inf(-1))
+		w.Sample("pty_nan", nil, nil, math.NaN())
+		w.Sample("pty_float", nil, nil, 1.5e-7)
+	}))
+
+	buf := new(bytes.Buffer)
+	if err := r.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP pty_sessions_total Sessions started.
+# TYPE pty_sessions_total counter
+pty_sessions_total{device="pts0"} 2
+pty_sessions_total{device="pts1"} 2
+# HELP pty_clients Clients attached.\nPer \\ device.
+# TYPE pty_clients gauge
+pty_clients{device="pts0",profile="a \"quoted\"\n\\ value"} 3
+# HELP pty_attach_seconds Attach duration.
+# TYPE pty_attach_seconds histogram
+pty_attach_seconds_bucket{device="pts0",le="0.5"} 2
+pty_attach_seconds_bucket{device="pts0",le="1"} 3
+pty_attach_seconds_bucket{device="pts0",le="10"} 4
+pty_attach_seconds_bucket{device="pts0",le="+Inf"} 5
+pty_attach_seconds_sum{device="pts0"} 26.3
+pty_attach_seconds_count{device="pts0"} 5
+# HELP pty_up Whether the plugin is up.
+# TYPE pty_up gauge
+pty_up 1
+pty_inf +Inf
+pty_inf -Inf
+pty_nan NaN
+pty_float 1.5e-07
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestHistogramVecWithoutLabels(t *testing.T) {
+	h := NewHistogramVec("latency", "Latency.", []float64{1})
+	h.Observe(2)
+
+	r := NewRegistry()
+	r.Register(h)
+
+	buf := new(bytes.Buffer)
+	if err := r.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP latency Latency.
+# TYPE latency histogram
+latency_bucket{le="1"} 0
+latency_bucket{le="+Inf"} 1
+latency_sum 2
+latency_count 1
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Register(CollectorFunc(func(w *Writer) {
+		w.Family("up", "Up.", TypeGauge)
+		w.Sample("up", nil, nil, 1)
+	}))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if body := rec.Body.String(); body != "# HELP up Up.\n# TYPE up gauge\nup 1\n" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -0,0 +1,188 @@
+package pty
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// identity the shell process runs as
+type identity struct {
+	uid    uint32
+	gid    uint32
+	groups []uint32
+	name   string
+	home   string
+}
+
+// lookupIdentity resolves user, primary group and supplementary groups,
+// all of them can be either name or numeric id, empty group defaults to the
+// primary group of the user, nil groups defaults to all groups of the user
+func lookupIdentity(userName, groupName string, groups []string) (*identity, error) {
+	u, err := lookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := parseID(u.Uid)
+	if err != nil {
+		return nil, err
+	}
+
+	gidStr := u.Gid
+	if groupName != "" {
+		g, err := lookupGroup(groupName)
+		if err != nil {
+			return nil, err
+		}
+		gidStr = g.Gid
+	}
+
+	gid, err := parseID(gidStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var groupIDs []string
+	if groups == nil {
+		groupIDs, err = u.GroupIds()
+		if err != nil {
+			return nil, fmt.Errorf("lookup groups of user %q failed: %v", u.Username, err)
+		}
+	} else {
+		for _, name := range groups {
+			g, err := lookupGroup(name)
+			if err != nil {
+				return nil, err
+			}
+			groupIDs = append(groupIDs, g.Gid)
+		}
+	}
+
+	id := &identity{uid: uid, gid: gid, name: u.Username, home: u.HomeDir}
+	for _, s := range groupIDs {
+		g, err := parseID(s)
+		if err != nil {
+			return nil, err
+		}
+		id.groups = append(id.groups, g)
+	}
+
+	return id, nil
+}
+
+// identity of the shell configured, nil if the shell runs as this process
+func (c Config) identity() (*identity, error) {
+	if c.User == "" && c.Group == "" && c.Groups == nil && !c.LoginShell {
+		return nil, nil
+	}
+
+	return lookupIdentity(c.User, c.Group, c.Groups)
+}
+
+// resolvePath makes relative path relative to home dir of the identity, or
+// the user of this process if id is nil
+func resolvePath(id *identity, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+
+	home := "/"
+	if id != nil {
+		home = id.home
+	} else if u, err := user.Current(); err == nil {
+		home = u.HomeDir
+	}
+
+	return filepath.Join(home, path)
+}
+
+// lookupOwner resolves owner in form of [user][:group], ids not specified
+// are -1
+func lookupOwner(owner string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	parts := strings.SplitN(owner, ":", 2)
+	if parts[0] != "" {
+		u, err := lookupUser(parts[0])
+		if err != nil {
+			return 0, 0, err
+		}
+
+		id, err := parseID(u.Uid)
+		if err != nil {
+			return 0, 0, err
+		}
+		uid = int(id)
+	}
+
+	if len(parts) == 2 && parts[1] != "" {
+		g, err := lookupGroup(parts[1])
+		if err != nil {
+			return 0, 0, err
+		}
+
+		id, err := parseID(g.Gid)
+		if err != nil {
+			return 0, 0, err
+		}
+		gid = int(id)
+	}
+
+	return uid, gid, nil
+}
+
+func (id *identity) credential() *syscall.Credential {
+	return &syscall.Credential{Uid: id.uid, Gid: id.gid, Groups: id.groups}
+}
+
+// environ returns env of the current process with user specific env replaced
+func (id *identity) environ(shell string) []string {
+	overrides := map[string]string{
+		"HOME":    id.home,
+		"USER":    id.name,
+		"LOGNAME": id.name,
+		"SHELL":   shell,
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if _, ok := overrides[strings.SplitN(kv, "=", 2)[0]]; !ok {
+			env = append(env, kv)
+		}
+	}
+
+	for _, k := range []string{"HOME", "USER", "LOGNAME", "SHELL"} {
+		env = append(env, k+"="+overrides[k])
+	}
+	return env
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if name == "" {
+		return user.Current()
+	}
+
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+func parseID(s string) (uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q: %v", s, err)
+	}
+	return uint32(id), nil
+}
@@ -0,0 +1,144 @@
+package pty
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+// Exec runs a command without pty as the same user of the shell, stdin,
+// stdout and stderr are streamed separately, processes left by the command
+// are terminated once it exited or the client has gone
+func (t *Terminal) Exec(srv Terminal_ExecServer) error {
+	if isReadOnly(srv.Context()) {
+		return status.Error(codes.PermissionDenied, "observers can not exec")
+	}
+
+	req, err := srv.Recv()
+	if err != nil {
+		return err
+	}
+
+	command := req.GetCommand()
+	if len(command) == 0 {
+		return status.Error(codes.InvalidArgument, "command not provided")
+	}
+
+	cmd, id, err := newCommand(t.config, command[0], command[1:]...)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		_ = stdoutR.Close()
+		_ = stdoutW.Close()
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// run in a new session, so we can find all processes of the command
+	cmd.SysProcAttr.Setsid = true
+
+	err = startCommand(cmd, id, t.config.Limits)
+	_ = stdoutW.Close()
+	_ = stderrW.Close()
+	if err != nil {
+		_ = stdoutR.Close()
+		_ = stderrR.Close()
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// the command is reaped by cmd.Wait, its pid can be reused afterwards
+	pid, startTime := cmd.Process.Pid, processStartTime(cmd.Process.Pid)
+
+	log.I("exec command", log.Strings("command", command), log.Int("pid", pid))
+
+	sendMu := &sync.Mutex{}
+	send := func(resp *ExecResponse) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+
+		return srv.Send(resp)
+	}
+
+	util.Workers.Add(func(func()) (interface{}, error) {
+		defer func() { _ = stdin.Close() }()
+
+		// forward user input, the first request may contain input as well
+		for {
+			if _, err := stdin.Write(req.GetStdin()); err != nil || req.GetStdinClosed() {
+				return nil, nil
+			}
+
+			if req, err = srv.Recv(); err != nil {
+				return nil, nil
+			}
+		}
+	})
+
+	wg := &sync.WaitGroup{}
+	forward := func(r io.ReadCloser, toResp func([]byte) *ExecResponse) {
+		defer wg.Done()
+		defer func() { _ = r.Close() }()
+
+		buf := make([]byte, outputChunkSize)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				data := make([]byte, n)
+				copy(data, buf[:n])
+				if err := send(toResp(data)); err != nil {
+					log.E("send exec output failed", log.Err(err))
+				}
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	wg.Add(2)
+	go forward(stdoutR, func(data []byte) *ExecResponse { return &ExecResponse{Stdout: data} })
+	go forward(stderrR, func(data []byte) *ExecResponse { return &ExecResponse{Stderr: data} })
+
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-exited:
+		case <-srv.Context().Done():
+			log.I("exec client gone, terminate command", log.Int("pid", pid))
+			logReaped(pid, killSession(pid, startTime, t.config.KillGracePeriod))
+		}
+	}()
+
+	_ = cmd.Wait()
+	close(exited)
+
+	// processes left may still hold stdout or stderr
+	logReaped(pid, killSession(pid, startTime, t.config.KillGracePeriod))
+	wg.Wait()
+
+	return send(&ExecResponse{Exit: exitStatus(cmd.ProcessState)})
+}
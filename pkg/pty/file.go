@@ -0,0 +1,379 @@
+package pty
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+// Upload writes a file or directory to the host with permissions of the
+// shell user
+func (t *Terminal) Upload(srv Terminal_UploadServer) error {
+	if isReadOnly(srv.Context()) {
+		return status.Error(codes.PermissionDenied, "observers can not upload files")
+	}
+
+	req, err := srv.Recv()
+	if err != nil {
+		return err
+	}
+
+	header := req.GetHeader()
+	if header.GetPath() == "" {
+		return status.Error(codes.InvalidArgument, "path not provided")
+	}
+
+	if header.Directory && req.Resume {
+		return status.Error(codes.InvalidArgument, "resume is not supported for directory")
+	}
+
+	id, err := t.config.identity()
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	u := &upload{
+		srv:  srv,
+		path: resolvePath(id, header.Path),
+		mode: os.FileMode(header.Mode).Perm(),
+		uid:  -1,
+		gid:  -1,
+		hash: sha256.New(),
+	}
+	switch {
+	case header.Mode != 0:
+	case header.Directory:
+		u.mode = 0755
+	default:
+		u.mode = 0644
+	}
+
+	if header.Owner != "" {
+		if u.uid, u.gid, err = lookupOwner(header.Owner); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	err = asIdentity(id, func() error {
+		if header.Directory {
+			return u.receiveDir()
+		}
+		return u.receiveFile(req.Resume, header.Size)
+	})
+	if err != nil {
+		log.I("upload failed", log.String("path", u.path), log.Err(err))
+		return fileError(err)
+	}
+
+	sum := hex.EncodeToString(u.hash.Sum(nil))
+	log.I("uploaded", log.String("path", u.path), log.Int64("size", u.size))
+	return srv.Send(&UploadResponse{Size: u.size, Sha256: sum})
+}
+
+type upload struct {
+	srv  Terminal_UploadServer
+	path string
+	mode os.FileMode
+	uid  int
+	gid  int
+
+	hash hash.Hash
+	size int64
+	// checksum expected by the client
+	checksum string
+}
+
+// receiveFile writes data received to the regular file, a partial file
+// uploaded before is appended if resume and not larger than size expected
+func (u *upload) receiveFile(resume bool, size int64) error {
+	f, err := os.OpenFile(u.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	offset := int64(0)
+	if resume {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() && info.Size() <= size {
+			offset = info.Size()
+		}
+
+		if _, err := io.CopyN(u.hash, f, offset); err != nil {
+			return err
+		}
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	u.size = offset
+	if err := u.srv.Send(&UploadResponse{Offset: offset}); err != nil {
+		return err
+	}
+
+	if err := u.recv(f); err != nil {
+		return err
+	}
+
+	if err := u.verify(); err != nil {
+		_ = os.Remove(u.path)
+		return err
+	}
+
+	if err := f.Chmod(u.mode); err != nil {
+		return err
+	}
+
+	return u.chown(u.path, nil)
+}
+
+// receiveDir extracts tar stream received into the directory
+func (u *upload) receiveDir() error {
+	if err := u.srv.Send(&UploadResponse{}); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		// no file access here
+		_ = pw.CloseWithError(u.recv(pw))
+	}()
+
+	err := util.ExtractTar(pr, u.path, u.chown)
+	if err == nil {
+		// consume paddings after the end of archive
+		_, err = io.Copy(ioutil.Discard, pr)
+	}
+	_ = pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	if err := u.verify(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(u.path, u.mode); err != nil {
+		return err
+	}
+
+	return u.chown(u.path, nil)
+}
+
+// recv writes data received to w until the client finished sending
+func (u *upload) recv(w io.Writer) error {
+	for {
+		req, err := u.srv.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(req.Data); err != nil {
+			return err
+		}
+
+		_, _ = u.hash.Write(req.Data)
+		u.size += int64(len(req.Data))
+		if req.Sha256 != "" {
+			u.checksum = req.Sha256
+		}
+	}
+}
+
+func (u *upload) verify() error {
+	sum := hex.EncodeToString(u.hash.Sum(nil))
+	if u.checksum != "" && !strings.EqualFold(u.checksum, sum) {
+		return status.Errorf(codes.DataLoss, "checksum mismatch, expected %s, got %s", u.checksum, sum)
+	}
+	return nil
+}
+
+func (u *upload) chown(path string, _ *tar.Header) error {
+	if u.uid == -1 && u.gid == -1 {
+		return nil
+	}
+	return os.Lchown(path, u.uid, u.gid)
+}
+
+// Download reads a file or directory from the host with permissions of the
+// shell user
+func (t *Terminal) Download(req *DownloadRequest, srv Terminal_DownloadServer) error {
+	if isReadOnly(srv.Context()) {
+		return status.Error(codes.PermissionDenied, "observers can not download files")
+	}
+
+	if req.Path == "" {
+		return status.Error(codes.InvalidArgument, "path not provided")
+	}
+
+	id, err := t.config.identity()
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	path := resolvePath(id, req.Path)
+	err = asIdentity(id, func() error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			if req.Offset != 0 {
+				return status.Error(codes.InvalidArgument, "offset is not supported for directory")
+			}
+			return sendDir(srv, path, info)
+		case info.Mode().IsRegular():
+			return sendFile(srv, path, req.Offset)
+		default:
+			return status.Error(codes.InvalidArgument, "neither a regular file nor a directory")
+		}
+	})
+	if err != nil {
+		log.I("download failed", log.String("path", path), log.Err(err))
+		return fileError(err)
+	}
+
+	log.I("downloaded", log.String("path", path))
+	return nil
+}
+
+func sendFile(srv Terminal_DownloadServer, path string, offset int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if offset < 0 || offset > info.Size() {
+		return status.Errorf(codes.OutOfRange, "offset %d out of file size %d", offset, info.Size())
+	}
+
+	// checksum covers the whole file
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, offset); err != nil {
+		return err
+	}
+
+	if err := srv.Send(&DownloadResponse{Header: fileHeader(path, info)}); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(io.MultiWriter(h, &downloadWriter{srv: srv}), f); err != nil {
+		return err
+	}
+
+	return srv.Send(&DownloadResponse{Sha256: hex.EncodeToString(h.Sum(nil))})
+}
+
+func sendDir(srv Terminal_DownloadServer, path string, info os.FileInfo) error {
+	if err := srv.Send(&DownloadResponse{Header: fileHeader(path, info)}); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	pr, pw := io.Pipe()
+	sendErrCh := make(chan error, 1)
+	go func() {
+		// no file access here
+		_, err := io.Copy(io.MultiWriter(h, &downloadWriter{srv: srv}), pr)
+		_ = pr.CloseWithError(err)
+		sendErrCh <- err
+	}()
+
+	bw := bufio.NewWriterSize(pw, outputChunkSize)
+	err := util.WriteTar(bw, path, true)
+	if err == nil {
+		err = bw.Flush()
+	}
+	_ = pw.CloseWithError(err)
+	if sendErr := <-sendErrCh; err == nil {
+		err = sendErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return srv.Send(&DownloadResponse{Sha256: hex.EncodeToString(h.Sum(nil))})
+}
+
+// downloadWriter sends data written as download responses
+type downloadWriter struct {
+	srv Terminal_DownloadServer
+}
+
+func (w *downloadWriter) Write(p []byte) (int, error) {
+	if err := w.srv.Send(&DownloadResponse{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func fileHeader(path string, info os.FileInfo) *FileHeader {
+	header := &FileHeader{
+		Path:      path,
+		Mode:      uint32(info.Mode().Perm()),
+		Directory: info.IsDir(),
+	}
+
+	if !info.IsDir() {
+		header.Size = info.Size()
+	}
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		header.Owner = strconv.FormatUint(uint64(st.Uid), 10) + ":" + strconv.FormatUint(uint64(st.Gid), 10)
+	}
+
+	return header
+}
+
+// fileError converts errors of file access to grpc status
+func fileError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case os.IsNotExist(err):
+		return status.Error(codes.NotFound, err.Error())
+	case os.IsPermission(err):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case os.IsExist(err):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
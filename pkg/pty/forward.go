@@ -0,0 +1,96 @@
+package pty
+
+import (
+	"io"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+const (
+	portForwardDialTimeout = 10 * time.Second
+)
+
+// PortForward dials the address on the host and tunnels the connection, the
+// connection is made with credentials of the shell user
+func (t *Terminal) PortForward(srv Terminal_PortForwardServer) error {
+	if isReadOnly(srv.Context()) {
+		return status.Error(codes.PermissionDenied, "observers can not forward ports")
+	}
+
+	req, err := srv.Recv()
+	if err != nil {
+		return err
+	}
+
+	switch req.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return status.Errorf(codes.InvalidArgument, "unsupported network %q", req.Network)
+	}
+
+	if req.Address == "" {
+		return status.Error(codes.InvalidArgument, "address not provided")
+	}
+
+	// abstract unix sockets have no file permissions to check
+	if req.Network == "unix" && (req.Address[0] == '@' || req.Address[0] == 0) {
+		return status.Error(codes.InvalidArgument, "abstract unix socket not allowed")
+	}
+
+	id, err := t.config.identity()
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	conn, err := dialAs(id, req.Network, req.Address)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer func() { _ = conn.Close() }()
+
+	addrField := log.String("address", req.Network+"://"+req.Address)
+	log.D("port forward started", addrField)
+	defer log.D("port forward finished", addrField)
+
+	util.Workers.Add(func(func()) (interface{}, error) {
+		// the first request may contain data as well
+		data := req.Data
+		for {
+			if _, err := conn.Write(data); err != nil {
+				return nil, nil
+			}
+
+			next, err := srv.Recv()
+			if err != nil {
+				// client finished sending, or the stream has gone
+				if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+					_ = cw.CloseWrite()
+				}
+				return nil, nil
+			}
+			data = next.Data
+		}
+	})
+
+	buf := make([]byte, outputChunkSize)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if err := srv.Send(&PortForwardResponse{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return status.Error(codes.Unavailable, err.Error())
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package pty
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"arhat.dev/kube-host-pty/pkg/util/log"
+	"arhat.dev/kube-host-pty/pkg/version"
+)
+
+// capabilities exchanged in handshake, features introduced along with or
+// after handshake should be listed here
+const (
+	// CapabilityControlFrames supports control frames in Attach stream
+	CapabilityControlFrames = "control-frames"
+	CapabilityExec          = "exec"
+	CapabilityFileTransfer  = "file-transfer"
+	CapabilityPortForward   = "port-forward"
+)
+
+// ServerCapabilities are capabilities of Terminal
+var ServerCapabilities = []string{
+	CapabilityControlFrames,
+	CapabilityExec,
+	CapabilityFileTransfer,
+	CapabilityPortForward,
+}
+
+// NewHello describes this process with capabilities
+func NewHello(capabilities []string) *Hello {
+	return &Hello{
+		Version:      version.Version(),
+		Commit:       version.Commit(),
+		Capabilities: capabilities,
+	}
+}
+
+// HasCapability returns true if the peer supports the capability
+func (m *Hello) HasCapability(capability string) bool {
+	for _, c := range m.GetCapabilities() {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Terminal) Handshake(ctx context.Context, req *Hello) (*Hello, error) {
+	log.D("handshake", log.String("client_version", req.GetVersion()),
+		log.String("client_commit", req.GetCommit()), log.Strings("client_capabilities", req.GetCapabilities()))
+	return NewHello(ServerCapabilities), nil
+}
+
+// checkClientVersion rejects clients older than the minimum version, clients
+// of versions not comparable (e.g. dev builds) are accepted
+func (t *Terminal) checkClientVersion(ctx context.Context) error {
+	minVersion := t.config.MinClientVersion
+	if minVersion == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	versions := md.Get(MetadataKeyClientVersion)
+	if len(versions) == 0 {
+		return status.Errorf(codes.FailedPrecondition,
+			"pty-client is too old, version %s or newer is required, please upgrade", minVersion)
+	}
+
+	if result, ok := version.Compare(versions[0], minVersion); ok && result < 0 {
+		return status.Errorf(codes.FailedPrecondition,
+			"pty-client %s is too old, version %s or newer is required, please upgrade", versions[0], minVersion)
+	}
+
+	return nil
+}
+
+// checkClient authorizes the peer process, checks its session token and
+// version
+func (t *Terminal) checkClient(ctx context.Context) error {
+	if err := t.authorize(ctx); err != nil {
+		return err
+	}
+
+	if err := t.checkToken(ctx); err != nil {
+		return err
+	}
+
+	return t.checkClientVersion(ctx)
+}
+
+func (t *Terminal) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := t.checkClient(ctx); err != nil {
+		log.I("client rejected", log.String("method", info.FullMethod), log.Err(err))
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (t *Terminal) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := t.checkClient(ss.Context()); err != nil {
+		log.I("client rejected", log.String("method", info.FullMethod), log.Err(err))
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,305 @@
+//go:build linux
+// +build linux
+
+package pty
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// helpers do what must not be done in the plugin process (e.g. switching
+// user) or can not be done between fork and exec in go (e.g. setting
+// resource limits), they are run by re-executing the plugin executable
+// with argv[0] set to the helper name, the spec in json as the first
+// argument and the fd 3 connected to the plugin to report errors
+const (
+	helperExec = "pty-exec-helper"
+	helperDial = "pty-dial-helper"
+
+	helperFd = 3
+	selfExe  = "/proc/self/exe"
+)
+
+func init() {
+	switch os.Args[0] {
+	case helperExec:
+		runHelper(execHelper)
+	case helperDial:
+		runHelper(dialHelper)
+	}
+}
+
+// helperSpec is passed to helpers
+type helperSpec struct {
+	// Credential to switch to, the helper keeps running as the plugin user
+	// if nil
+	Credential *syscall.Credential `json:"credential,omitempty"`
+	// Limits to set before switching credential
+	Limits Limits `json:"limits"`
+	// Dir to change to after switching credential
+	Dir string `json:"dir,omitempty"`
+}
+
+func (s *helperSpec) String() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func newHelperSpec(id *identity) *helperSpec {
+	spec := &helperSpec{}
+	if id != nil {
+		spec.Credential = id.credential()
+	}
+	return spec
+}
+
+// runHelper runs the helper and exits, the error returned by f is reported
+// to the plugin
+func runHelper(f func(spec *helperSpec, args []string) error) {
+	spec := &helperSpec{}
+	err := errors.New("helper spec not provided")
+	if len(os.Args) > 1 {
+		err = json.Unmarshal([]byte(os.Args[1]), spec)
+	}
+
+	if err == nil {
+		err = f(spec, os.Args[2:])
+	}
+
+	if err != nil {
+		_, _ = os.NewFile(helperFd, "helper").Write([]byte(err.Error()))
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// switchCredential switches all threads of the helper to the credential,
+// real, effective and saved ids are all switched, so the helper can not
+// switch back
+func switchCredential(cred *syscall.Credential) error {
+	if cred == nil {
+		return nil
+	}
+
+	runtime.LockOSThread()
+
+	groups := make([]int, len(cred.Groups))
+	for i, g := range cred.Groups {
+		groups[i] = int(g)
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("set groups failed: %v", err)
+	}
+	if err := syscall.Setgid(int(cred.Gid)); err != nil {
+		return fmt.Errorf("set gid failed: %v", err)
+	}
+	if err := syscall.Setuid(int(cred.Uid)); err != nil {
+		return fmt.Errorf("set uid failed: %v", err)
+	}
+	return nil
+}
+
+// setLimits sets resource limits of the helper, which are inherited by
+// the command executed and all processes it forks
+func setLimits(limits Limits) error {
+	for resource, limit := range map[int]uint64{
+		unix.RLIMIT_NOFILE: limits.MaxOpenFiles,
+		unix.RLIMIT_NPROC:  limits.MaxProcesses,
+		unix.RLIMIT_AS:     limits.MaxMemoryBytes,
+		unix.RLIMIT_CPU:    limits.MaxCPUSeconds,
+		unix.RLIMIT_FSIZE:  limits.MaxFileSizeBytes,
+	} {
+		if limit == 0 {
+			continue
+		}
+
+		if err := unix.Setrlimit(resource, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("set resource limits failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// execHelper executes the command in args (path and argv) with limits
+// set and credential switched, the fd to the plugin is closed on success
+func execHelper(spec *helperSpec, args []string) error {
+	if len(args) < 2 {
+		return errors.New("command not provided")
+	}
+
+	if err := setLimits(spec.Limits); err != nil {
+		return err
+	}
+
+	if err := switchCredential(spec.Credential); err != nil {
+		return err
+	}
+
+	if spec.Dir != "" {
+		if err := os.Chdir(spec.Dir); err != nil {
+			return err
+		}
+	}
+
+	unix.CloseOnExec(helperFd)
+	return unix.Exec(args[0], args[1:], os.Environ())
+}
+
+// startCommand starts cmd through the exec helper if limits are set or
+// id is not nil, limits are set and credential of id is switched to before
+// executing cmd, so they apply to cmd and all processes it forks from the
+// very beginning, errors before executing cmd are returned
+func startCommand(cmd *exec.Cmd, id *identity, limits Limits) error {
+	if id == nil && limits == (Limits{}) {
+		return cmd.Start()
+	}
+
+	spec := newHelperSpec(id)
+	spec.Limits, spec.Dir = limits, cmd.Dir
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{helperExec, spec.String(), cmd.Path}, cmd.Args...)
+	cmd.Path, cmd.Dir = selfExe, ""
+	cmd.ExtraFiles = []*os.File{w}
+
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		_ = r.Close()
+		return err
+	}
+
+	// closed on exec
+	msg, _ := ioutil.ReadAll(r)
+	_ = r.Close()
+	if len(msg) > 0 {
+		_ = cmd.Wait()
+		return errors.New(string(msg))
+	}
+
+	return nil
+}
+
+// dialHelper dials the network address in args and sends the connection fd
+// to the plugin
+func dialHelper(spec *helperSpec, args []string) error {
+	if len(args) != 2 {
+		return errors.New("network and address not provided")
+	}
+
+	if err := switchCredential(spec.Credential); err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout(args[0], args[1], portForwardDialTimeout)
+	if err != nil {
+		return err
+	}
+
+	f, err := conn.(interface{ File() (*os.File, error) }).File()
+	if err != nil {
+		return err
+	}
+
+	return unix.Sendmsg(helperFd, []byte{0}, unix.UnixRights(int(f.Fd())), nil, 0)
+}
+
+// dialAs dials the address with credentials of id, the connection is made
+// in a helper process switched to id if not nil, so the peer sees the real
+// credentials of id (e.g. SO_PEERCRED), and file permissions of unix
+// sockets are checked against id
+func dialAs(id *identity, network, address string) (net.Conn, error) {
+	if id == nil {
+		return net.DialTimeout(network, address, portForwardDialTimeout)
+	}
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	local, remote := os.NewFile(uintptr(fds[0]), "helper"), os.NewFile(uintptr(fds[1]), "helper")
+	defer func() { _ = local.Close() }()
+
+	cmd := &exec.Cmd{
+		Path:       selfExe,
+		Args:       []string{helperDial, newHelperSpec(id).String(), network, address},
+		ExtraFiles: []*os.File{remote},
+	}
+	err = cmd.Start()
+	_ = remote.Close()
+	if err != nil {
+		return nil, fmt.Errorf("start dial helper failed: %v", err)
+	}
+	defer func() { _ = cmd.Wait() }()
+
+	// read until the helper exited, the connection fd is sent along with one
+	// byte, the error message otherwise
+	var (
+		msg []byte
+		fd  = -1
+		buf = make([]byte, 512)
+		oob = make([]byte, unix.CmsgSpace(4))
+	)
+	for {
+		n, oobn, _, _, err := unix.Recvmsg(int(local.Fd()), buf, oob, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 && oobn == 0 {
+			break
+		}
+
+		if oobn > 0 && fd == -1 {
+			if fd, err = parseRights(oob[:oobn]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		msg = append(msg, buf[:n]...)
+	}
+
+	if fd == -1 {
+		if len(msg) == 0 {
+			return nil, errors.New("dial helper exited unexpectedly")
+		}
+		return nil, errors.New(string(msg))
+	}
+
+	f := os.NewFile(uintptr(fd), address)
+	defer func() { _ = f.Close() }()
+
+	return net.FileConn(f)
+}
+
+// parseRights returns the fd in the socket control message
+func parseRights(oob []byte) (int, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil || len(msgs) == 0 {
+		return -1, fmt.Errorf("invalid control message: %v", err)
+	}
+
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		return -1, fmt.Errorf("invalid fd received: %v", err)
+	}
+
+	return fds[0], nil
+}
@@ -0,0 +1,204 @@
+package pty
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDialAs(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("switching user requires root")
+	}
+
+	dir, err := ioutil.TempDir("", "pty-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	listen := func(name string, mode os.FileMode) (string, net.Listener) {
+		t.Helper()
+
+		d := filepath.Join(dir, name)
+		if err := os.Mkdir(d, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(d, mode); err != nil {
+			t.Fatal(err)
+		}
+
+		socket := filepath.Join(d, "sock")
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(socket, 0777); err != nil {
+			t.Fatal(err)
+		}
+		return socket, l
+	}
+
+	public, publicListener := listen("public", 0755)
+	defer func() { _ = publicListener.Close() }()
+	private, privateListener := listen("private", 0700)
+	defer func() { _ = privateListener.Close() }()
+
+	nobody := &identity{uid: 65534, gid: 65534, groups: []uint32{65534}}
+
+	for _, c := range []struct {
+		name        string
+		id          *identity
+		socket      string
+		listener    net.Listener
+		expectedUID uint32
+		err         bool
+	}{
+		{"plugin user", nil, private, privateListener, 0, false},
+		{"other user", nobody, public, publicListener, 65534, false},
+		{"other user permission denied", nobody, private, privateListener, 0, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			conn, err := dialAs(c.id, "unix", c.socket)
+			if c.err {
+				if err == nil {
+					_ = conn.Close()
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = conn.Close() }()
+
+			accepted, err := c.listener.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = accepted.Close() }()
+
+			cred, err := getPeerCred(accepted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cred.Uid != c.expectedUID || cred.Pid == os.Getpid() && c.id != nil {
+				t.Errorf("unexpected peer credential %+v", cred)
+			}
+
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 4)
+			if _, err := accepted.Read(buf); err != nil || string(buf) != "ping" {
+				t.Errorf("unexpected data %q: %v", buf, err)
+			}
+		})
+	}
+
+	if _, err := dialAs(nobody, "tcp", "127.0.0.1:0"); err == nil {
+		t.Error("expected dial error reported by helper")
+	}
+}
+
+// fakePortForwardServer receives the request only
+type fakePortForwardServer struct {
+	grpc.ServerStream
+
+	req *PortForwardRequest
+}
+
+func (s *fakePortForwardServer) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakePortForwardServer) Recv() (*PortForwardRequest, error) {
+	return s.req, nil
+}
+
+func (s *fakePortForwardServer) Send(*PortForwardResponse) error {
+	return nil
+}
+
+func TestPortForwardRejectsAbstractSocket(t *testing.T) {
+	for _, address := range []string{"@/org/freedesktop/dbus", "\x00dbus"} {
+		err := (&Terminal{}).PortForward(&fakePortForwardServer{req: &PortForwardRequest{Network: "unix", Address: address}})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected abstract socket %q rejected, got %v", address, err)
+		}
+	}
+}
+
+func TestStartCommand(t *testing.T) {
+	nobody := &identity{uid: 65534, gid: 65534, groups: []uint32{65534}}
+
+	for _, c := range []struct {
+		name     string
+		id       *identity
+		limits   Limits
+		dir      string
+		script   string
+		expected string
+		err      bool
+		root     bool
+	}{
+		{"no helper", nil, Limits{}, "", "echo ok", "ok\n", false, false},
+		{
+			// limits apply to processes forked by the command
+			"limits",
+			nil,
+			Limits{MaxOpenFiles: 100, MaxMemoryBytes: 16 << 20},
+			"",
+			`sh -c "ulimit -n"; ulimit -v`,
+			"100\n16384\n",
+			false,
+			false,
+		},
+		{"dir", nil, Limits{MaxOpenFiles: 100}, "/", "pwd", "/\n", false, false},
+		{"dir not found", nil, Limits{MaxOpenFiles: 100}, "/not-found", "pwd", "", true, false},
+		{"invalid limit", nil, Limits{MaxCPUSeconds: 1, MaxOpenFiles: 1 << 62}, "", "true", "", true, false},
+		{"other user", nobody, Limits{}, "/", "id -u; id -g; id -G; pwd", "65534\n65534\n65534\n/\n", false, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if c.root && os.Getuid() != 0 {
+				t.Skip("switching user requires root")
+			}
+
+			cmd := exec.Command("sh", "-c", c.script)
+			cmd.Dir = c.dir
+			stdout := new(bytes.Buffer)
+			cmd.Stdout = stdout
+
+			err := startCommand(cmd, c.id, c.limits)
+			if c.err {
+				if err == nil {
+					_ = cmd.Wait()
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cmd.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != c.expected {
+				t.Errorf("expected output %q, got %q", c.expected, stdout.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package pty
+
+// Limits of resource usage, zero value means unlimited (inherited from the
+// plugin process)
+type Limits struct {
+	// MaxOpenFiles is the max count of file descriptors of each process
+	MaxOpenFiles uint64 `yaml:"max_open_files"`
+	// MaxProcesses is the max count of processes of the user
+	MaxProcesses uint64 `yaml:"max_processes"`
+	// MaxMemoryBytes is the max virtual memory size of each process
+	MaxMemoryBytes uint64 `yaml:"max_memory_bytes"`
+	// MaxCPUSeconds is the max cpu time of each process
+	MaxCPUSeconds uint64 `yaml:"max_cpu_seconds"`
+	// MaxFileSizeBytes is the max size of files created
+	MaxFileSizeBytes uint64 `yaml:"max_file_size_bytes"`
+}
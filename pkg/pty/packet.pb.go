@@ -23,101 +23,1266 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
-type Bytes struct {
+type ExitReason int32
+
+const (
+	// the shell exited by itself
+	ExitReason_SHELL_EXITED ExitReason = 0
+	// the session was closed by the device plugin, e.g. the pod was deleted
+	// or the device was allocated again
+	ExitReason_SESSION_RECLAIMED ExitReason = 1
+	// no input for longer than the idle timeout
+	ExitReason_IDLE_TIMEOUT ExitReason = 2
+	// terminated by the administrator, e.g. the device was disabled
+	ExitReason_ADMIN_TERMINATED ExitReason = 3
+)
+
+var ExitReason_name = map[int32]string{
+	0: "SHELL_EXITED",
+	1: "SESSION_RECLAIMED",
+	2: "IDLE_TIMEOUT",
+	3: "ADMIN_TERMINATED",
+}
+var ExitReason_value = map[string]int32{
+	"SHELL_EXITED":      0,
+	"SESSION_RECLAIMED": 1,
+	"IDLE_TIMEOUT":      2,
+	"ADMIN_TERMINATED":  3,
+}
+
+func (x ExitReason) String() string {
+	return proto.EnumName(ExitReason_name, int32(x))
+}
+func (ExitReason) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{0}
+}
+
+type SignalRequest_Name int32
+
+const (
+	SignalRequest_INT  SignalRequest_Name = 0
+	SignalRequest_TERM SignalRequest_Name = 1
+	SignalRequest_KILL SignalRequest_Name = 2
+	SignalRequest_QUIT SignalRequest_Name = 3
+	SignalRequest_TSTP SignalRequest_Name = 4
+)
+
+var SignalRequest_Name_name = map[int32]string{
+	0: "INT",
+	1: "TERM",
+	2: "KILL",
+	3: "QUIT",
+	4: "TSTP",
+}
+var SignalRequest_Name_value = map[string]int32{
+	"INT":  0,
+	"TERM": 1,
+	"KILL": 2,
+	"QUIT": 3,
+	"TSTP": 4,
+}
+
+func (x SignalRequest_Name) String() string {
+	return proto.EnumName(SignalRequest_Name_name, int32(x))
+}
+func (SignalRequest_Name) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{5, 0}
+}
+
+// Frame is the message of Attach stream in both directions, it's wire
+// compatible with the Bytes message used before, data, completed, presence
+// and exit keep their field numbers, so peers using Bytes see other frames
+// as empty data
+//
+// both sides send hello as the first frame, resize, signal and keepalive
+// are only sent to peers which have sent hello, presence and exit are sent
+// to all clients, since clients using Bytes with presence and exit decode
+// them as before, and older clients see them as empty data
+type Frame struct {
+	// Types that are valid to be assigned to Frame:
+	//	*Frame_Data
+	//	*Frame_Presence
+	//	*Frame_Exit
+	//	*Frame_Resize
+	//	*Frame_Signal
+	//	*Frame_Keepalive
+	//	*Frame_Hello
+	Frame isFrame_Frame `protobuf_oneof:"frame"`
+	// completed is set along with exit in the last frame
+	Completed            bool     `protobuf:"varint,2,opt,name=completed,proto3" json:"completed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Frame) Reset()         { *m = Frame{} }
+func (m *Frame) String() string { return proto.CompactTextString(m) }
+func (*Frame) ProtoMessage()    {}
+func (*Frame) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{0}
+}
+func (m *Frame) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Frame.Unmarshal(m, b)
+}
+func (m *Frame) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Frame.Marshal(b, m, deterministic)
+}
+func (dst *Frame) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Frame.Merge(dst, src)
+}
+func (m *Frame) XXX_Size() int {
+	return xxx_messageInfo_Frame.Size(m)
+}
+func (m *Frame) XXX_DiscardUnknown() {
+	xxx_messageInfo_Frame.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Frame proto.InternalMessageInfo
+
+type isFrame_Frame interface {
+	isFrame_Frame()
+}
+
+type Frame_Data struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3,oneof"`
+}
+
+type Frame_Presence struct {
+	Presence *Presence `protobuf:"bytes,3,opt,name=presence,proto3,oneof"`
+}
+
+type Frame_Exit struct {
+	Exit *Exit `protobuf:"bytes,4,opt,name=exit,proto3,oneof"`
+}
+
+type Frame_Resize struct {
+	Resize *Size `protobuf:"bytes,5,opt,name=resize,proto3,oneof"`
+}
+
+type Frame_Signal struct {
+	Signal *SignalRequest `protobuf:"bytes,6,opt,name=signal,proto3,oneof"`
+}
+
+type Frame_Keepalive struct {
+	Keepalive *Keepalive `protobuf:"bytes,7,opt,name=keepalive,proto3,oneof"`
+}
+
+type Frame_Hello struct {
+	Hello *Hello `protobuf:"bytes,8,opt,name=hello,proto3,oneof"`
+}
+
+func (*Frame_Data) isFrame_Frame() {}
+
+func (*Frame_Presence) isFrame_Frame() {}
+
+func (*Frame_Exit) isFrame_Frame() {}
+
+func (*Frame_Resize) isFrame_Frame() {}
+
+func (*Frame_Signal) isFrame_Frame() {}
+
+func (*Frame_Keepalive) isFrame_Frame() {}
+
+func (*Frame_Hello) isFrame_Frame() {}
+
+func (m *Frame) GetFrame() isFrame_Frame {
+	if m != nil {
+		return m.Frame
+	}
+	return nil
+}
+
+func (m *Frame) GetData() []byte {
+	if x, ok := m.GetFrame().(*Frame_Data); ok {
+		return x.Data
+	}
+	return nil
+}
+
+func (m *Frame) GetPresence() *Presence {
+	if x, ok := m.GetFrame().(*Frame_Presence); ok {
+		return x.Presence
+	}
+	return nil
+}
+
+func (m *Frame) GetExit() *Exit {
+	if x, ok := m.GetFrame().(*Frame_Exit); ok {
+		return x.Exit
+	}
+	return nil
+}
+
+func (m *Frame) GetResize() *Size {
+	if x, ok := m.GetFrame().(*Frame_Resize); ok {
+		return x.Resize
+	}
+	return nil
+}
+
+func (m *Frame) GetSignal() *SignalRequest {
+	if x, ok := m.GetFrame().(*Frame_Signal); ok {
+		return x.Signal
+	}
+	return nil
+}
+
+func (m *Frame) GetKeepalive() *Keepalive {
+	if x, ok := m.GetFrame().(*Frame_Keepalive); ok {
+		return x.Keepalive
+	}
+	return nil
+}
+
+func (m *Frame) GetHello() *Hello {
+	if x, ok := m.GetFrame().(*Frame_Hello); ok {
+		return x.Hello
+	}
+	return nil
+}
+
+func (m *Frame) GetCompleted() bool {
+	if m != nil {
+		return m.Completed
+	}
+	return false
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*Frame) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
+	return _Frame_OneofMarshaler, _Frame_OneofUnmarshaler, _Frame_OneofSizer, []interface{}{
+		(*Frame_Data)(nil),
+		(*Frame_Presence)(nil),
+		(*Frame_Exit)(nil),
+		(*Frame_Resize)(nil),
+		(*Frame_Signal)(nil),
+		(*Frame_Keepalive)(nil),
+		(*Frame_Hello)(nil),
+	}
+}
+
+func _Frame_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*Frame)
+	// frame
+	switch x := m.Frame.(type) {
+	case *Frame_Data:
+		b.EncodeVarint(1<<3 | proto.WireBytes)
+		b.EncodeRawBytes(x.Data)
+	case *Frame_Presence:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Presence); err != nil {
+			return err
+		}
+	case *Frame_Exit:
+		b.EncodeVarint(4<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Exit); err != nil {
+			return err
+		}
+	case *Frame_Resize:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Resize); err != nil {
+			return err
+		}
+	case *Frame_Signal:
+		b.EncodeVarint(6<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Signal); err != nil {
+			return err
+		}
+	case *Frame_Keepalive:
+		b.EncodeVarint(7<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Keepalive); err != nil {
+			return err
+		}
+	case *Frame_Hello:
+		b.EncodeVarint(8<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Hello); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		return fmt.Errorf("Frame.Frame has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _Frame_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*Frame)
+	switch tag {
+	case 1: // frame.data
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeRawBytes(true)
+		m.Frame = &Frame_Data{x}
+		return true, err
+	case 3: // frame.presence
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Presence)
+		err := b.DecodeMessage(msg)
+		m.Frame = &Frame_Presence{msg}
+		return true, err
+	case 4: // frame.exit
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Exit)
+		err := b.DecodeMessage(msg)
+		m.Frame = &Frame_Exit{msg}
+		return true, err
+	case 5: // frame.resize
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Size)
+		err := b.DecodeMessage(msg)
+		m.Frame = &Frame_Resize{msg}
+		return true, err
+	case 6: // frame.signal
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(SignalRequest)
+		err := b.DecodeMessage(msg)
+		m.Frame = &Frame_Signal{msg}
+		return true, err
+	case 7: // frame.keepalive
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Keepalive)
+		err := b.DecodeMessage(msg)
+		m.Frame = &Frame_Keepalive{msg}
+		return true, err
+	case 8: // frame.hello
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Hello)
+		err := b.DecodeMessage(msg)
+		m.Frame = &Frame_Hello{msg}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+func _Frame_OneofSizer(msg proto.Message) (n int) {
+	m := msg.(*Frame)
+	// frame
+	switch x := m.Frame.(type) {
+	case *Frame_Data:
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(len(x.Data)))
+		n += len(x.Data)
+	case *Frame_Presence:
+		s := proto.Size(x.Presence)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *Frame_Exit:
+		s := proto.Size(x.Exit)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *Frame_Resize:
+		s := proto.Size(x.Resize)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *Frame_Signal:
+		s := proto.Size(x.Signal)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *Frame_Keepalive:
+		s := proto.Size(x.Keepalive)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *Frame_Hello:
+		s := proto.Size(x.Hello)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case nil:
+	default:
+		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
+	}
+	return n
+}
+
+// Hello describes the peer, sent in Handshake and as the first frame of
+// Attach
+type Hello struct {
+	// version and commit the peer built with
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Commit  string `protobuf:"bytes,2,opt,name=commit,proto3" json:"commit,omitempty"`
+	// capabilities supported by the peer
+	Capabilities         []string `protobuf:"bytes,3,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Hello) Reset()         { *m = Hello{} }
+func (m *Hello) String() string { return proto.CompactTextString(m) }
+func (*Hello) ProtoMessage()    {}
+func (*Hello) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{1}
+}
+func (m *Hello) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Hello.Unmarshal(m, b)
+}
+func (m *Hello) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Hello.Marshal(b, m, deterministic)
+}
+func (dst *Hello) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Hello.Merge(dst, src)
+}
+func (m *Hello) XXX_Size() int {
+	return xxx_messageInfo_Hello.Size(m)
+}
+func (m *Hello) XXX_DiscardUnknown() {
+	xxx_messageInfo_Hello.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Hello proto.InternalMessageInfo
+
+func (m *Hello) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *Hello) GetCommit() string {
+	if m != nil {
+		return m.Commit
+	}
+	return ""
+}
+
+func (m *Hello) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+type Keepalive struct {
+	// seq is replied in the ack
+	Seq                  uint64   `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Ack                  bool     `protobuf:"varint,2,opt,name=ack,proto3" json:"ack,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Keepalive) Reset()         { *m = Keepalive{} }
+func (m *Keepalive) String() string { return proto.CompactTextString(m) }
+func (*Keepalive) ProtoMessage()    {}
+func (*Keepalive) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{2}
+}
+func (m *Keepalive) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Keepalive.Unmarshal(m, b)
+}
+func (m *Keepalive) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Keepalive.Marshal(b, m, deterministic)
+}
+func (dst *Keepalive) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Keepalive.Merge(dst, src)
+}
+func (m *Keepalive) XXX_Size() int {
+	return xxx_messageInfo_Keepalive.Size(m)
+}
+func (m *Keepalive) XXX_DiscardUnknown() {
+	xxx_messageInfo_Keepalive.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Keepalive proto.InternalMessageInfo
+
+func (m *Keepalive) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *Keepalive) GetAck() bool {
+	if m != nil {
+		return m.Ack
+	}
+	return false
+}
+
+type Presence struct {
+	// writers are clients attached with input allowed
+	Writers uint32 `protobuf:"varint,1,opt,name=writers,proto3" json:"writers,omitempty"`
+	// observers are clients attached in read-only mode
+	Observers            uint32   `protobuf:"varint,2,opt,name=observers,proto3" json:"observers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Presence) Reset()         { *m = Presence{} }
+func (m *Presence) String() string { return proto.CompactTextString(m) }
+func (*Presence) ProtoMessage()    {}
+func (*Presence) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{3}
+}
+func (m *Presence) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Presence.Unmarshal(m, b)
+}
+func (m *Presence) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Presence.Marshal(b, m, deterministic)
+}
+func (dst *Presence) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Presence.Merge(dst, src)
+}
+func (m *Presence) XXX_Size() int {
+	return xxx_messageInfo_Presence.Size(m)
+}
+func (m *Presence) XXX_DiscardUnknown() {
+	xxx_messageInfo_Presence.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Presence proto.InternalMessageInfo
+
+func (m *Presence) GetWriters() uint32 {
+	if m != nil {
+		return m.Writers
+	}
+	return 0
+}
+
+func (m *Presence) GetObservers() uint32 {
+	if m != nil {
+		return m.Observers
+	}
+	return 0
+}
+
+type Size struct {
+	Cols                 uint32   `protobuf:"varint,1,opt,name=cols,proto3" json:"cols,omitempty"`
+	Rows                 uint32   `protobuf:"varint,2,opt,name=rows,proto3" json:"rows,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Size) Reset()         { *m = Size{} }
+func (m *Size) String() string { return proto.CompactTextString(m) }
+func (*Size) ProtoMessage()    {}
+func (*Size) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{4}
+}
+func (m *Size) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Size.Unmarshal(m, b)
+}
+func (m *Size) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Size.Marshal(b, m, deterministic)
+}
+func (dst *Size) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Size.Merge(dst, src)
+}
+func (m *Size) XXX_Size() int {
+	return xxx_messageInfo_Size.Size(m)
+}
+func (m *Size) XXX_DiscardUnknown() {
+	xxx_messageInfo_Size.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Size proto.InternalMessageInfo
+
+func (m *Size) GetCols() uint32 {
+	if m != nil {
+		return m.Cols
+	}
+	return 0
+}
+
+func (m *Size) GetRows() uint32 {
+	if m != nil {
+		return m.Rows
+	}
+	return 0
+}
+
+type SignalRequest struct {
+	Name SignalRequest_Name `protobuf:"varint,1,opt,name=name,proto3,enum=pty.SignalRequest_Name" json:"name,omitempty"`
+	// session sends the signal to all processes in the session instead of
+	// the foreground process group
+	Session              bool     `protobuf:"varint,2,opt,name=session,proto3" json:"session,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SignalRequest) Reset()         { *m = SignalRequest{} }
+func (m *SignalRequest) String() string { return proto.CompactTextString(m) }
+func (*SignalRequest) ProtoMessage()    {}
+func (*SignalRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{5}
+}
+func (m *SignalRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SignalRequest.Unmarshal(m, b)
+}
+func (m *SignalRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SignalRequest.Marshal(b, m, deterministic)
+}
+func (dst *SignalRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SignalRequest.Merge(dst, src)
+}
+func (m *SignalRequest) XXX_Size() int {
+	return xxx_messageInfo_SignalRequest.Size(m)
+}
+func (m *SignalRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SignalRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SignalRequest proto.InternalMessageInfo
+
+func (m *SignalRequest) GetName() SignalRequest_Name {
+	if m != nil {
+		return m.Name
+	}
+	return SignalRequest_INT
+}
+
+func (m *SignalRequest) GetSession() bool {
+	if m != nil {
+		return m.Session
+	}
+	return false
+}
+
+type SignalResponse struct {
+	// pids of processes signaled
+	Pids                 []int32  `protobuf:"varint,1,rep,packed,name=pids,proto3" json:"pids,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SignalResponse) Reset()         { *m = SignalResponse{} }
+func (m *SignalResponse) String() string { return proto.CompactTextString(m) }
+func (*SignalResponse) ProtoMessage()    {}
+func (*SignalResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{6}
+}
+func (m *SignalResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SignalResponse.Unmarshal(m, b)
+}
+func (m *SignalResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SignalResponse.Marshal(b, m, deterministic)
+}
+func (dst *SignalResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SignalResponse.Merge(dst, src)
+}
+func (m *SignalResponse) XXX_Size() int {
+	return xxx_messageInfo_SignalResponse.Size(m)
+}
+func (m *SignalResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SignalResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SignalResponse proto.InternalMessageInfo
+
+func (m *SignalResponse) GetPids() []int32 {
+	if m != nil {
+		return m.Pids
+	}
+	return nil
+}
+
+type ExecRequest struct {
+	// command and args, only set in the first request
+	Command []string `protobuf:"bytes,1,rep,name=command,proto3" json:"command,omitempty"`
+	Stdin   []byte   `protobuf:"bytes,2,opt,name=stdin,proto3" json:"stdin,omitempty"`
+	// stdin_closed closes stdin of the command
+	StdinClosed          bool     `protobuf:"varint,3,opt,name=stdin_closed,json=stdinClosed,proto3" json:"stdin_closed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExecRequest) Reset()         { *m = ExecRequest{} }
+func (m *ExecRequest) String() string { return proto.CompactTextString(m) }
+func (*ExecRequest) ProtoMessage()    {}
+func (*ExecRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{7}
+}
+func (m *ExecRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExecRequest.Unmarshal(m, b)
+}
+func (m *ExecRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExecRequest.Marshal(b, m, deterministic)
+}
+func (dst *ExecRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExecRequest.Merge(dst, src)
+}
+func (m *ExecRequest) XXX_Size() int {
+	return xxx_messageInfo_ExecRequest.Size(m)
+}
+func (m *ExecRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExecRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExecRequest proto.InternalMessageInfo
+
+func (m *ExecRequest) GetCommand() []string {
+	if m != nil {
+		return m.Command
+	}
+	return nil
+}
+
+func (m *ExecRequest) GetStdin() []byte {
+	if m != nil {
+		return m.Stdin
+	}
+	return nil
+}
+
+func (m *ExecRequest) GetStdinClosed() bool {
+	if m != nil {
+		return m.StdinClosed
+	}
+	return false
+}
+
+type ExecResponse struct {
+	Stdout []byte `protobuf:"bytes,1,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	Stderr []byte `protobuf:"bytes,2,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	// exit is only set in the last response
+	Exit                 *Exit    `protobuf:"bytes,3,opt,name=exit,proto3" json:"exit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExecResponse) Reset()         { *m = ExecResponse{} }
+func (m *ExecResponse) String() string { return proto.CompactTextString(m) }
+func (*ExecResponse) ProtoMessage()    {}
+func (*ExecResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{8}
+}
+func (m *ExecResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExecResponse.Unmarshal(m, b)
+}
+func (m *ExecResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExecResponse.Marshal(b, m, deterministic)
+}
+func (dst *ExecResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExecResponse.Merge(dst, src)
+}
+func (m *ExecResponse) XXX_Size() int {
+	return xxx_messageInfo_ExecResponse.Size(m)
+}
+func (m *ExecResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExecResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExecResponse proto.InternalMessageInfo
+
+func (m *ExecResponse) GetStdout() []byte {
+	if m != nil {
+		return m.Stdout
+	}
+	return nil
+}
+
+func (m *ExecResponse) GetStderr() []byte {
+	if m != nil {
+		return m.Stderr
+	}
+	return nil
+}
+
+func (m *ExecResponse) GetExit() *Exit {
+	if m != nil {
+		return m.Exit
+	}
+	return nil
+}
+
+type FileHeader struct {
+	// path on the host, relative ones are relative to home dir of the shell
+	// user
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// permission bits, defaults to 0644 for files and 0755 for directories
+	Mode uint32 `protobuf:"varint,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	// directory is transferred as a tar stream of its content
+	Directory bool `protobuf:"varint,3,opt,name=directory,proto3" json:"directory,omitempty"`
+	// size of the regular file
+	Size int64 `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	// owner in form of user[:group], defaults to the shell user
+	Owner                string   `protobuf:"bytes,5,opt,name=owner,proto3" json:"owner,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FileHeader) Reset()         { *m = FileHeader{} }
+func (m *FileHeader) String() string { return proto.CompactTextString(m) }
+func (*FileHeader) ProtoMessage()    {}
+func (*FileHeader) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{9}
+}
+func (m *FileHeader) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FileHeader.Unmarshal(m, b)
+}
+func (m *FileHeader) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FileHeader.Marshal(b, m, deterministic)
+}
+func (dst *FileHeader) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileHeader.Merge(dst, src)
+}
+func (m *FileHeader) XXX_Size() int {
+	return xxx_messageInfo_FileHeader.Size(m)
+}
+func (m *FileHeader) XXX_DiscardUnknown() {
+	xxx_messageInfo_FileHeader.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FileHeader proto.InternalMessageInfo
+
+func (m *FileHeader) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *FileHeader) GetMode() uint32 {
+	if m != nil {
+		return m.Mode
+	}
+	return 0
+}
+
+func (m *FileHeader) GetDirectory() bool {
+	if m != nil {
+		return m.Directory
+	}
+	return false
+}
+
+func (m *FileHeader) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *FileHeader) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+type UploadRequest struct {
+	// header is only set in the first request
+	Header *FileHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// resume appends to the partial file uploaded before, regular file only
+	Resume bool   `protobuf:"varint,2,opt,name=resume,proto3" json:"resume,omitempty"`
+	Data   []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	// sha256 of the whole file in hex, only set in the last request,
+	// verified by the server if set
+	Sha256               string   `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UploadRequest) Reset()         { *m = UploadRequest{} }
+func (m *UploadRequest) String() string { return proto.CompactTextString(m) }
+func (*UploadRequest) ProtoMessage()    {}
+func (*UploadRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{10}
+}
+func (m *UploadRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UploadRequest.Unmarshal(m, b)
+}
+func (m *UploadRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UploadRequest.Marshal(b, m, deterministic)
+}
+func (dst *UploadRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UploadRequest.Merge(dst, src)
+}
+func (m *UploadRequest) XXX_Size() int {
+	return xxx_messageInfo_UploadRequest.Size(m)
+}
+func (m *UploadRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UploadRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UploadRequest proto.InternalMessageInfo
+
+func (m *UploadRequest) GetHeader() *FileHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *UploadRequest) GetResume() bool {
+	if m != nil {
+		return m.Resume
+	}
+	return false
+}
+
+func (m *UploadRequest) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *UploadRequest) GetSha256() string {
+	if m != nil {
+		return m.Sha256
+	}
+	return ""
+}
+
+type UploadResponse struct {
+	// offset of the file data should start from, only set in the first
+	// response
+	Offset int64 `protobuf:"varint,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	// size and sha256 of the whole file, only set in the last response
+	Size                 int64    `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Sha256               string   `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UploadResponse) Reset()         { *m = UploadResponse{} }
+func (m *UploadResponse) String() string { return proto.CompactTextString(m) }
+func (*UploadResponse) ProtoMessage()    {}
+func (*UploadResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{11}
+}
+func (m *UploadResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UploadResponse.Unmarshal(m, b)
+}
+func (m *UploadResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UploadResponse.Marshal(b, m, deterministic)
+}
+func (dst *UploadResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UploadResponse.Merge(dst, src)
+}
+func (m *UploadResponse) XXX_Size() int {
+	return xxx_messageInfo_UploadResponse.Size(m)
+}
+func (m *UploadResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_UploadResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UploadResponse proto.InternalMessageInfo
+
+func (m *UploadResponse) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *UploadResponse) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *UploadResponse) GetSha256() string {
+	if m != nil {
+		return m.Sha256
+	}
+	return ""
+}
+
+type DownloadRequest struct {
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// offset to read from, regular file only
+	Offset               int64    `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DownloadRequest) Reset()         { *m = DownloadRequest{} }
+func (m *DownloadRequest) String() string { return proto.CompactTextString(m) }
+func (*DownloadRequest) ProtoMessage()    {}
+func (*DownloadRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{12}
+}
+func (m *DownloadRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DownloadRequest.Unmarshal(m, b)
+}
+func (m *DownloadRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DownloadRequest.Marshal(b, m, deterministic)
+}
+func (dst *DownloadRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DownloadRequest.Merge(dst, src)
+}
+func (m *DownloadRequest) XXX_Size() int {
+	return xxx_messageInfo_DownloadRequest.Size(m)
+}
+func (m *DownloadRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DownloadRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DownloadRequest proto.InternalMessageInfo
+
+func (m *DownloadRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *DownloadRequest) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+type DownloadResponse struct {
+	// header is only set in the first response
+	Header *FileHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Data   []byte      `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// sha256 of the whole file in hex, only set in the last response
+	Sha256               string   `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DownloadResponse) Reset()         { *m = DownloadResponse{} }
+func (m *DownloadResponse) String() string { return proto.CompactTextString(m) }
+func (*DownloadResponse) ProtoMessage()    {}
+func (*DownloadResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{13}
+}
+func (m *DownloadResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DownloadResponse.Unmarshal(m, b)
+}
+func (m *DownloadResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DownloadResponse.Marshal(b, m, deterministic)
+}
+func (dst *DownloadResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DownloadResponse.Merge(dst, src)
+}
+func (m *DownloadResponse) XXX_Size() int {
+	return xxx_messageInfo_DownloadResponse.Size(m)
+}
+func (m *DownloadResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DownloadResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DownloadResponse proto.InternalMessageInfo
+
+func (m *DownloadResponse) GetHeader() *FileHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *DownloadResponse) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *DownloadResponse) GetSha256() string {
+	if m != nil {
+		return m.Sha256
+	}
+	return ""
+}
+
+type PortForwardRequest struct {
+	// network (tcp or unix) and address to dial, only set in the first
+	// request
+	Network              string   `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	Address              string   `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	Data                 []byte   `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PortForwardRequest) Reset()         { *m = PortForwardRequest{} }
+func (m *PortForwardRequest) String() string { return proto.CompactTextString(m) }
+func (*PortForwardRequest) ProtoMessage()    {}
+func (*PortForwardRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{14}
+}
+func (m *PortForwardRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PortForwardRequest.Unmarshal(m, b)
+}
+func (m *PortForwardRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PortForwardRequest.Marshal(b, m, deterministic)
+}
+func (dst *PortForwardRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PortForwardRequest.Merge(dst, src)
+}
+func (m *PortForwardRequest) XXX_Size() int {
+	return xxx_messageInfo_PortForwardRequest.Size(m)
+}
+func (m *PortForwardRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PortForwardRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PortForwardRequest proto.InternalMessageInfo
+
+func (m *PortForwardRequest) GetNetwork() string {
+	if m != nil {
+		return m.Network
+	}
+	return ""
+}
+
+func (m *PortForwardRequest) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *PortForwardRequest) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type PortForwardResponse struct {
 	Data                 []byte   `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
-	Completed            bool     `protobuf:"varint,2,opt,name=completed,proto3" json:"completed,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *Bytes) Reset()         { *m = Bytes{} }
-func (m *Bytes) String() string { return proto.CompactTextString(m) }
-func (*Bytes) ProtoMessage()    {}
-func (*Bytes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_packet_e772e5c429200560, []int{0}
+func (m *PortForwardResponse) Reset()         { *m = PortForwardResponse{} }
+func (m *PortForwardResponse) String() string { return proto.CompactTextString(m) }
+func (*PortForwardResponse) ProtoMessage()    {}
+func (*PortForwardResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{15}
 }
-func (m *Bytes) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_Bytes.Unmarshal(m, b)
+func (m *PortForwardResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PortForwardResponse.Unmarshal(m, b)
 }
-func (m *Bytes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_Bytes.Marshal(b, m, deterministic)
+func (m *PortForwardResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PortForwardResponse.Marshal(b, m, deterministic)
 }
-func (dst *Bytes) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_Bytes.Merge(dst, src)
+func (dst *PortForwardResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PortForwardResponse.Merge(dst, src)
 }
-func (m *Bytes) XXX_Size() int {
-	return xxx_messageInfo_Bytes.Size(m)
+func (m *PortForwardResponse) XXX_Size() int {
+	return xxx_messageInfo_PortForwardResponse.Size(m)
 }
-func (m *Bytes) XXX_DiscardUnknown() {
-	xxx_messageInfo_Bytes.DiscardUnknown(m)
+func (m *PortForwardResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PortForwardResponse.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_Bytes proto.InternalMessageInfo
+var xxx_messageInfo_PortForwardResponse proto.InternalMessageInfo
 
-func (m *Bytes) GetData() []byte {
+func (m *PortForwardResponse) GetData() []byte {
 	if m != nil {
 		return m.Data
 	}
 	return nil
 }
 
-func (m *Bytes) GetCompleted() bool {
-	if m != nil {
-		return m.Completed
-	}
-	return false
-}
-
-type Size struct {
-	Cols                 uint32   `protobuf:"varint,1,opt,name=cols,proto3" json:"cols,omitempty"`
-	Rows                 uint32   `protobuf:"varint,2,opt,name=rows,proto3" json:"rows,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+type Exit struct {
+	// exit code of the shell, -1 if unknown (e.g. terminated by signal, or
+	// the session was taken over from another process)
+	Code int32 `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	// signal terminated the shell, 0 if not signaled
+	Signal               int32      `protobuf:"varint,2,opt,name=signal,proto3" json:"signal,omitempty"`
+	Reason               ExitReason `protobuf:"varint,3,opt,name=reason,proto3,enum=pty.ExitReason" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
 }
 
-func (m *Size) Reset()         { *m = Size{} }
-func (m *Size) String() string { return proto.CompactTextString(m) }
-func (*Size) ProtoMessage()    {}
-func (*Size) Descriptor() ([]byte, []int) {
-	return fileDescriptor_packet_e772e5c429200560, []int{1}
+func (m *Exit) Reset()         { *m = Exit{} }
+func (m *Exit) String() string { return proto.CompactTextString(m) }
+func (*Exit) ProtoMessage()    {}
+func (*Exit) Descriptor() ([]byte, []int) {
+	return fileDescriptor_packet_a32ea128d777c65d, []int{16}
 }
-func (m *Size) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_Size.Unmarshal(m, b)
+func (m *Exit) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Exit.Unmarshal(m, b)
 }
-func (m *Size) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_Size.Marshal(b, m, deterministic)
+func (m *Exit) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Exit.Marshal(b, m, deterministic)
 }
-func (dst *Size) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_Size.Merge(dst, src)
+func (dst *Exit) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Exit.Merge(dst, src)
 }
-func (m *Size) XXX_Size() int {
-	return xxx_messageInfo_Size.Size(m)
+func (m *Exit) XXX_Size() int {
+	return xxx_messageInfo_Exit.Size(m)
 }
-func (m *Size) XXX_DiscardUnknown() {
-	xxx_messageInfo_Size.DiscardUnknown(m)
+func (m *Exit) XXX_DiscardUnknown() {
+	xxx_messageInfo_Exit.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_Size proto.InternalMessageInfo
+var xxx_messageInfo_Exit proto.InternalMessageInfo
 
-func (m *Size) GetCols() uint32 {
+func (m *Exit) GetCode() int32 {
 	if m != nil {
-		return m.Cols
+		return m.Code
 	}
 	return 0
 }
 
-func (m *Size) GetRows() uint32 {
+func (m *Exit) GetSignal() int32 {
 	if m != nil {
-		return m.Rows
+		return m.Signal
 	}
 	return 0
 }
 
+func (m *Exit) GetReason() ExitReason {
+	if m != nil {
+		return m.Reason
+	}
+	return ExitReason_SHELL_EXITED
+}
+
 func init() {
-	proto.RegisterType((*Bytes)(nil), "pty.Bytes")
+	proto.RegisterType((*Frame)(nil), "pty.Frame")
+	proto.RegisterType((*Hello)(nil), "pty.Hello")
+	proto.RegisterType((*Keepalive)(nil), "pty.Keepalive")
+	proto.RegisterType((*Presence)(nil), "pty.Presence")
 	proto.RegisterType((*Size)(nil), "pty.Size")
+	proto.RegisterType((*SignalRequest)(nil), "pty.SignalRequest")
+	proto.RegisterType((*SignalResponse)(nil), "pty.SignalResponse")
+	proto.RegisterType((*ExecRequest)(nil), "pty.ExecRequest")
+	proto.RegisterType((*ExecResponse)(nil), "pty.ExecResponse")
+	proto.RegisterType((*FileHeader)(nil), "pty.FileHeader")
+	proto.RegisterType((*UploadRequest)(nil), "pty.UploadRequest")
+	proto.RegisterType((*UploadResponse)(nil), "pty.UploadResponse")
+	proto.RegisterType((*DownloadRequest)(nil), "pty.DownloadRequest")
+	proto.RegisterType((*DownloadResponse)(nil), "pty.DownloadResponse")
+	proto.RegisterType((*PortForwardRequest)(nil), "pty.PortForwardRequest")
+	proto.RegisterType((*PortForwardResponse)(nil), "pty.PortForwardResponse")
+	proto.RegisterType((*Exit)(nil), "pty.Exit")
+	proto.RegisterEnum("pty.ExitReason", ExitReason_name, ExitReason_value)
+	proto.RegisterEnum("pty.SignalRequest_Name", SignalRequest_Name_name, SignalRequest_Name_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -132,8 +1297,32 @@ const _ = grpc.SupportPackageIsVersion4
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type TerminalClient interface {
+	// Handshake exchanges versions and capabilities, clients should check
+	// capabilities before using features
+	Handshake(ctx context.Context, in *Hello, opts ...grpc.CallOption) (*Hello, error)
+	// Attach streams frames of the terminal in both directions
 	Attach(ctx context.Context, opts ...grpc.CallOption) (Terminal_AttachClient, error)
+	// Resize is kept for clients not supporting resize frame
 	Resize(ctx context.Context, in *Size, opts ...grpc.CallOption) (*Size, error)
+	// Signal sends signal to foreground process group of the terminal, or
+	// all processes in the session, kept for clients not supporting signal
+	// frame
+	Signal(ctx context.Context, in *SignalRequest, opts ...grpc.CallOption) (*SignalResponse, error)
+	// Exec runs a command without pty, the first request must contain the
+	// command, the last response contains exit status
+	Exec(ctx context.Context, opts ...grpc.CallOption) (Terminal_ExecClient, error)
+	// Upload writes a file or directory to the host, the first request must
+	// contain the header, the first response contains the offset to send
+	// data from, the last one contains size and checksum of what's written
+	Upload(ctx context.Context, opts ...grpc.CallOption) (Terminal_UploadClient, error)
+	// Download reads a file or directory from the host, the first response
+	// contains the header, the last one contains the checksum
+	Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (Terminal_DownloadClient, error)
+	// PortForward tunnels a connection to a tcp or unix address on the host,
+	// the first request must contain the address, closing the send direction
+	// closes the write side of the connection, the stream ends once the host
+	// side closed the connection
+	PortForward(ctx context.Context, opts ...grpc.CallOption) (Terminal_PortForwardClient, error)
 }
 
 type terminalClient struct {
@@ -144,6 +1333,15 @@ func NewTerminalClient(cc *grpc.ClientConn) TerminalClient {
 	return &terminalClient{cc}
 }
 
+func (c *terminalClient) Handshake(ctx context.Context, in *Hello, opts ...grpc.CallOption) (*Hello, error) {
+	out := new(Hello)
+	err := c.cc.Invoke(ctx, "/pty.Terminal/Handshake", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *terminalClient) Attach(ctx context.Context, opts ...grpc.CallOption) (Terminal_AttachClient, error) {
 	stream, err := c.cc.NewStream(ctx, &_Terminal_serviceDesc.Streams[0], "/pty.Terminal/Attach", opts...)
 	if err != nil {
@@ -154,8 +1352,8 @@ func (c *terminalClient) Attach(ctx context.Context, opts ...grpc.CallOption) (T
 }
 
 type Terminal_AttachClient interface {
-	Send(*Bytes) error
-	Recv() (*Bytes, error)
+	Send(*Frame) error
+	Recv() (*Frame, error)
 	grpc.ClientStream
 }
 
@@ -163,12 +1361,12 @@ type terminalAttachClient struct {
 	grpc.ClientStream
 }
 
-func (x *terminalAttachClient) Send(m *Bytes) error {
+func (x *terminalAttachClient) Send(m *Frame) error {
 	return x.ClientStream.SendMsg(m)
 }
 
-func (x *terminalAttachClient) Recv() (*Bytes, error) {
-	m := new(Bytes)
+func (x *terminalAttachClient) Recv() (*Frame, error) {
+	m := new(Frame)
 	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
@@ -184,23 +1382,199 @@ func (c *terminalClient) Resize(ctx context.Context, in *Size, opts ...grpc.Call
 	return out, nil
 }
 
+func (c *terminalClient) Signal(ctx context.Context, in *SignalRequest, opts ...grpc.CallOption) (*SignalResponse, error) {
+	out := new(SignalResponse)
+	err := c.cc.Invoke(ctx, "/pty.Terminal/Signal", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *terminalClient) Exec(ctx context.Context, opts ...grpc.CallOption) (Terminal_ExecClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Terminal_serviceDesc.Streams[1], "/pty.Terminal/Exec", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &terminalExecClient{stream}
+	return x, nil
+}
+
+type Terminal_ExecClient interface {
+	Send(*ExecRequest) error
+	Recv() (*ExecResponse, error)
+	grpc.ClientStream
+}
+
+type terminalExecClient struct {
+	grpc.ClientStream
+}
+
+func (x *terminalExecClient) Send(m *ExecRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *terminalExecClient) Recv() (*ExecResponse, error) {
+	m := new(ExecResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *terminalClient) Upload(ctx context.Context, opts ...grpc.CallOption) (Terminal_UploadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Terminal_serviceDesc.Streams[2], "/pty.Terminal/Upload", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &terminalUploadClient{stream}
+	return x, nil
+}
+
+type Terminal_UploadClient interface {
+	Send(*UploadRequest) error
+	Recv() (*UploadResponse, error)
+	grpc.ClientStream
+}
+
+type terminalUploadClient struct {
+	grpc.ClientStream
+}
+
+func (x *terminalUploadClient) Send(m *UploadRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *terminalUploadClient) Recv() (*UploadResponse, error) {
+	m := new(UploadResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *terminalClient) Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (Terminal_DownloadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Terminal_serviceDesc.Streams[3], "/pty.Terminal/Download", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &terminalDownloadClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Terminal_DownloadClient interface {
+	Recv() (*DownloadResponse, error)
+	grpc.ClientStream
+}
+
+type terminalDownloadClient struct {
+	grpc.ClientStream
+}
+
+func (x *terminalDownloadClient) Recv() (*DownloadResponse, error) {
+	m := new(DownloadResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *terminalClient) PortForward(ctx context.Context, opts ...grpc.CallOption) (Terminal_PortForwardClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Terminal_serviceDesc.Streams[4], "/pty.Terminal/PortForward", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &terminalPortForwardClient{stream}
+	return x, nil
+}
+
+type Terminal_PortForwardClient interface {
+	Send(*PortForwardRequest) error
+	Recv() (*PortForwardResponse, error)
+	grpc.ClientStream
+}
+
+type terminalPortForwardClient struct {
+	grpc.ClientStream
+}
+
+func (x *terminalPortForwardClient) Send(m *PortForwardRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *terminalPortForwardClient) Recv() (*PortForwardResponse, error) {
+	m := new(PortForwardResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // TerminalServer is the server API for Terminal service.
 type TerminalServer interface {
+	// Handshake exchanges versions and capabilities, clients should check
+	// capabilities before using features
+	Handshake(context.Context, *Hello) (*Hello, error)
+	// Attach streams frames of the terminal in both directions
 	Attach(Terminal_AttachServer) error
+	// Resize is kept for clients not supporting resize frame
 	Resize(context.Context, *Size) (*Size, error)
+	// Signal sends signal to foreground process group of the terminal, or
+	// all processes in the session, kept for clients not supporting signal
+	// frame
+	Signal(context.Context, *SignalRequest) (*SignalResponse, error)
+	// Exec runs a command without pty, the first request must contain the
+	// command, the last response contains exit status
+	Exec(Terminal_ExecServer) error
+	// Upload writes a file or directory to the host, the first request must
+	// contain the header, the first response contains the offset to send
+	// data from, the last one contains size and checksum of what's written
+	Upload(Terminal_UploadServer) error
+	// Download reads a file or directory from the host, the first response
+	// contains the header, the last one contains the checksum
+	Download(*DownloadRequest, Terminal_DownloadServer) error
+	// PortForward tunnels a connection to a tcp or unix address on the host,
+	// the first request must contain the address, closing the send direction
+	// closes the write side of the connection, the stream ends once the host
+	// side closed the connection
+	PortForward(Terminal_PortForwardServer) error
 }
 
 func RegisterTerminalServer(s *grpc.Server, srv TerminalServer) {
 	s.RegisterService(&_Terminal_serviceDesc, srv)
 }
 
+func _Terminal_Handshake_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Hello)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TerminalServer).Handshake(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pty.Terminal/Handshake",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TerminalServer).Handshake(ctx, req.(*Hello))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Terminal_Attach_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(TerminalServer).Attach(&terminalAttachServer{stream})
 }
 
 type Terminal_AttachServer interface {
-	Send(*Bytes) error
-	Recv() (*Bytes, error)
+	Send(*Frame) error
+	Recv() (*Frame, error)
 	grpc.ServerStream
 }
 
@@ -208,12 +1582,12 @@ type terminalAttachServer struct {
 	grpc.ServerStream
 }
 
-func (x *terminalAttachServer) Send(m *Bytes) error {
+func (x *terminalAttachServer) Send(m *Frame) error {
 	return x.ServerStream.SendMsg(m)
 }
 
-func (x *terminalAttachServer) Recv() (*Bytes, error) {
-	m := new(Bytes)
+func (x *terminalAttachServer) Recv() (*Frame, error) {
+	m := new(Frame)
 	if err := x.ServerStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
@@ -238,14 +1612,139 @@ func _Terminal_Resize_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Terminal_Signal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TerminalServer).Signal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pty.Terminal/Signal",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TerminalServer).Signal(ctx, req.(*SignalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Terminal_Exec_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TerminalServer).Exec(&terminalExecServer{stream})
+}
+
+type Terminal_ExecServer interface {
+	Send(*ExecResponse) error
+	Recv() (*ExecRequest, error)
+	grpc.ServerStream
+}
+
+type terminalExecServer struct {
+	grpc.ServerStream
+}
+
+func (x *terminalExecServer) Send(m *ExecResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *terminalExecServer) Recv() (*ExecRequest, error) {
+	m := new(ExecRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Terminal_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TerminalServer).Upload(&terminalUploadServer{stream})
+}
+
+type Terminal_UploadServer interface {
+	Send(*UploadResponse) error
+	Recv() (*UploadRequest, error)
+	grpc.ServerStream
+}
+
+type terminalUploadServer struct {
+	grpc.ServerStream
+}
+
+func (x *terminalUploadServer) Send(m *UploadResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *terminalUploadServer) Recv() (*UploadRequest, error) {
+	m := new(UploadRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Terminal_Download_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TerminalServer).Download(m, &terminalDownloadServer{stream})
+}
+
+type Terminal_DownloadServer interface {
+	Send(*DownloadResponse) error
+	grpc.ServerStream
+}
+
+type terminalDownloadServer struct {
+	grpc.ServerStream
+}
+
+func (x *terminalDownloadServer) Send(m *DownloadResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Terminal_PortForward_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TerminalServer).PortForward(&terminalPortForwardServer{stream})
+}
+
+type Terminal_PortForwardServer interface {
+	Send(*PortForwardResponse) error
+	Recv() (*PortForwardRequest, error)
+	grpc.ServerStream
+}
+
+type terminalPortForwardServer struct {
+	grpc.ServerStream
+}
+
+func (x *terminalPortForwardServer) Send(m *PortForwardResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *terminalPortForwardServer) Recv() (*PortForwardRequest, error) {
+	m := new(PortForwardRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Terminal_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pty.Terminal",
 	HandlerType: (*TerminalServer)(nil),
 	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Handshake",
+			Handler:    _Terminal_Handshake_Handler,
+		},
 		{
 			MethodName: "Resize",
 			Handler:    _Terminal_Resize_Handler,
 		},
+		{
+			MethodName: "Signal",
+			Handler:    _Terminal_Signal_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -254,24 +1753,101 @@ var _Terminal_serviceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Exec",
+			Handler:       _Terminal_Exec_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Upload",
+			Handler:       _Terminal_Upload_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Download",
+			Handler:       _Terminal_Download_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PortForward",
+			Handler:       _Terminal_PortForward_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "packet.proto",
 }
 
-func init() { proto.RegisterFile("packet.proto", fileDescriptor_packet_e772e5c429200560) }
-
-var fileDescriptor_packet_e772e5c429200560 = []byte{
-	// 182 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x29, 0x48, 0x4c, 0xce,
-	0x4e, 0x2d, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2e, 0x28, 0xa9, 0x54, 0xb2, 0xe4,
-	0x62, 0x75, 0xaa, 0x2c, 0x49, 0x2d, 0x16, 0x12, 0xe2, 0x62, 0x49, 0x49, 0x2c, 0x49, 0x94, 0x60,
-	0x54, 0x60, 0xd4, 0xe0, 0x09, 0x02, 0xb3, 0x85, 0x64, 0xb8, 0x38, 0x93, 0xf3, 0x73, 0x0b, 0x72,
-	0x52, 0x4b, 0x52, 0x53, 0x24, 0x98, 0x14, 0x18, 0x35, 0x38, 0x82, 0x10, 0x02, 0x4a, 0x7a, 0x5c,
-	0x2c, 0xc1, 0x99, 0x55, 0xa9, 0x20, 0x9d, 0xc9, 0xf9, 0x39, 0xc5, 0x60, 0x9d, 0xbc, 0x41, 0x60,
-	0x36, 0x48, 0xac, 0x28, 0xbf, 0xbc, 0x18, 0xac, 0x89, 0x37, 0x08, 0xcc, 0x36, 0x0a, 0xe0, 0xe2,
-	0x08, 0x49, 0x2d, 0xca, 0xcd, 0xcc, 0x4b, 0xcc, 0x11, 0x52, 0xe1, 0x62, 0x73, 0x2c, 0x29, 0x49,
-	0x4c, 0xce, 0x10, 0xe2, 0xd2, 0x2b, 0x28, 0xa9, 0xd4, 0x03, 0xbb, 0x41, 0x0a, 0x89, 0xad, 0xc1,
-	0x68, 0xc0, 0x28, 0x24, 0xc7, 0xc5, 0x16, 0x94, 0x5a, 0x0c, 0xb2, 0x83, 0x13, 0x2c, 0x03, 0xb2,
-	0x4e, 0x0a, 0xc1, 0x4c, 0x62, 0x03, 0x7b, 0xc4, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x7f, 0x3a,
-	0x21, 0x9c, 0xd8, 0x00, 0x00, 0x00,
+func init() { proto.RegisterFile("packet.proto", fileDescriptor_packet_a32ea128d777c65d) }
+
+var fileDescriptor_packet_a32ea128d777c65d = []byte{
+	// 1041 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0x5f, 0x6f, 0xdb, 0x36,
+	0x10, 0xb7, 0x2d, 0x5b, 0xb1, 0x2e, 0x4e, 0xaa, 0x32, 0x69, 0x27, 0x18, 0xfb, 0x93, 0xa9, 0x05,
+	0xe6, 0xad, 0x83, 0xdb, 0x65, 0xe8, 0x86, 0x3d, 0xec, 0x21, 0xad, 0x15, 0xd8, 0xa8, 0x93, 0x66,
+	0xb4, 0x03, 0x0c, 0xd8, 0x82, 0x8c, 0x91, 0x98, 0x5a, 0x88, 0x2d, 0xaa, 0xa4, 0x52, 0x27, 0x45,
+	0xbf, 0xc3, 0xb0, 0x8f, 0xb3, 0x6f, 0x37, 0xf0, 0x44, 0x45, 0x72, 0x92, 0x87, 0xbd, 0xdd, 0xfd,
+	0xf8, 0x3b, 0xf2, 0x77, 0x47, 0xde, 0x49, 0xd0, 0x49, 0x59, 0x78, 0xc1, 0xb3, 0x7e, 0x2a, 0x45,
+	0x26, 0x88, 0x95, 0x66, 0xd7, 0xfe, 0xbf, 0x0d, 0x68, 0xed, 0x4b, 0xb6, 0xe0, 0x64, 0x1b, 0x9a,
+	0x11, 0xcb, 0x98, 0x57, 0xdf, 0xa9, 0xf7, 0x3a, 0xc3, 0x1a, 0x45, 0x8f, 0x3c, 0x83, 0x76, 0x2a,
+	0xb9, 0xe2, 0x49, 0xc8, 0x3d, 0x6b, 0xa7, 0xde, 0x5b, 0xdf, 0xdd, 0xe8, 0xa7, 0xd9, 0x75, 0xff,
+	0xc8, 0x80, 0xc3, 0x1a, 0xbd, 0x21, 0x90, 0xaf, 0xa0, 0xc9, 0xaf, 0xe2, 0xcc, 0x6b, 0x22, 0xd1,
+	0x41, 0x62, 0x70, 0x15, 0x67, 0x7a, 0x37, 0xbd, 0x40, 0x9e, 0x80, 0x2d, 0xb9, 0x8a, 0x3f, 0x72,
+	0xaf, 0x55, 0xa1, 0x4c, 0xe2, 0x8f, 0x7a, 0x1f, 0xb3, 0x44, 0xbe, 0x07, 0x5b, 0xc5, 0xef, 0x12,
+	0x36, 0xf7, 0x6c, 0x24, 0x11, 0x43, 0xd2, 0x10, 0xe5, 0xef, 0x2f, 0xb9, 0xd2, 0x1b, 0x1a, 0x0e,
+	0xe9, 0x83, 0x73, 0xc1, 0x79, 0xca, 0xe6, 0xf1, 0x07, 0xee, 0xad, 0x61, 0xc0, 0x26, 0x06, 0xbc,
+	0x29, 0xd0, 0x61, 0x8d, 0x96, 0x14, 0xe2, 0x43, 0x6b, 0xc6, 0xe7, 0x73, 0xe1, 0xb5, 0x91, 0x0b,
+	0xc8, 0x1d, 0x6a, 0x64, 0x58, 0xa3, 0xf9, 0x12, 0xf9, 0x1c, 0x9c, 0x50, 0x2c, 0xd2, 0x39, 0xcf,
+	0x78, 0xe4, 0x35, 0x76, 0xea, 0xbd, 0x36, 0x2d, 0x81, 0x57, 0x6b, 0xd0, 0x3a, 0xd7, 0x15, 0xf3,
+	0x4f, 0xa0, 0x85, 0x81, 0xc4, 0x83, 0xb5, 0x0f, 0x5c, 0xaa, 0x58, 0x24, 0x58, 0x3d, 0x87, 0x16,
+	0x2e, 0x79, 0x0c, 0x76, 0x28, 0x16, 0x8b, 0x38, 0xc3, 0x6d, 0x1c, 0x6a, 0x3c, 0xe2, 0x43, 0x27,
+	0x64, 0x29, 0x3b, 0x8b, 0xe7, 0x71, 0x16, 0x73, 0xe5, 0x59, 0x3b, 0x56, 0xcf, 0xa1, 0x2b, 0x98,
+	0xff, 0x1c, 0x9c, 0x9b, 0x1c, 0x88, 0x0b, 0x96, 0xe2, 0xef, 0x71, 0xfb, 0x26, 0xd5, 0xa6, 0x46,
+	0x58, 0x78, 0x61, 0xe4, 0x69, 0xd3, 0x7f, 0x05, 0xed, 0xe2, 0x5a, 0xb4, 0xa4, 0xa5, 0x8c, 0x33,
+	0x2e, 0x15, 0xc6, 0x6c, 0xd0, 0xc2, 0xd5, 0xc9, 0x89, 0x33, 0xc5, 0xa5, 0x96, 0x88, 0xd1, 0x1b,
+	0xb4, 0x04, 0xfc, 0x3e, 0x34, 0xf5, 0x75, 0x10, 0x02, 0xcd, 0x50, 0xcc, 0x8b, 0x60, 0xb4, 0x35,
+	0x26, 0xc5, 0xb2, 0x08, 0x42, 0xdb, 0xff, 0xbb, 0x0e, 0x1b, 0x2b, 0x57, 0x43, 0x9e, 0x41, 0x33,
+	0x61, 0x0b, 0x8e, 0x91, 0x9b, 0xbb, 0x9f, 0xdd, 0xbd, 0xbc, 0xfe, 0x21, 0x5b, 0x70, 0x8a, 0x24,
+	0x2d, 0x53, 0x71, 0x85, 0x95, 0xcb, 0x13, 0x29, 0x5c, 0xff, 0x67, 0x68, 0x6a, 0x1e, 0x59, 0x03,
+	0x6b, 0x74, 0x38, 0x75, 0x6b, 0xa4, 0x0d, 0xcd, 0x69, 0x40, 0x0f, 0xdc, 0xba, 0xb6, 0xde, 0x8c,
+	0xc6, 0x63, 0xb7, 0xa1, 0xad, 0xdf, 0x8e, 0x47, 0x53, 0xd7, 0xc2, 0xd5, 0xc9, 0xf4, 0xc8, 0x6d,
+	0xfa, 0x4f, 0x61, 0xb3, 0x38, 0x4e, 0xa5, 0x22, 0x51, 0x98, 0x4b, 0x1a, 0x47, 0x3a, 0x17, 0xab,
+	0xd7, 0xa2, 0x68, 0xfb, 0x7f, 0xc1, 0x7a, 0x70, 0xc5, 0xc3, 0x42, 0xb4, 0x07, 0x6b, 0xfa, 0x66,
+	0x58, 0x12, 0x21, 0xcb, 0xa1, 0x85, 0x4b, 0xb6, 0xa1, 0xa5, 0xb2, 0x28, 0xce, 0xf5, 0x75, 0x68,
+	0xee, 0x90, 0xaf, 0xa1, 0x83, 0xc6, 0x69, 0x38, 0x17, 0x8a, 0x47, 0xd8, 0x1a, 0x6d, 0xba, 0x8e,
+	0xd8, 0x6b, 0x84, 0xfc, 0x13, 0xe8, 0xe4, 0x27, 0x18, 0x15, 0x8f, 0xc1, 0x56, 0x59, 0x24, 0x2e,
+	0xb3, 0xbc, 0xc3, 0xa8, 0xf1, 0x0c, 0xce, 0xa5, 0x34, 0x27, 0x18, 0x8f, 0x7c, 0x61, 0x9a, 0xc9,
+	0xba, 0xd5, 0x4c, 0x79, 0x2b, 0xf9, 0x9f, 0x00, 0xf6, 0xe3, 0x39, 0x1f, 0x72, 0x16, 0x71, 0x89,
+	0x29, 0xb2, 0x6c, 0x66, 0x9e, 0x1f, 0xda, 0x1a, 0x5b, 0x88, 0x88, 0x17, 0xd7, 0xa5, 0x6d, 0x7d,
+	0xf9, 0x51, 0x2c, 0x79, 0x98, 0x09, 0x79, 0x6d, 0x44, 0x97, 0x80, 0x8e, 0xc0, 0xe6, 0xd4, 0xfd,
+	0x6b, 0x51, 0xb4, 0x75, 0xfe, 0x62, 0x99, 0x70, 0x89, 0x1d, 0xeb, 0xd0, 0xdc, 0xf1, 0x3f, 0xc1,
+	0xc6, 0x71, 0x3a, 0x17, 0x2c, 0x2a, 0x0a, 0xf8, 0x0d, 0xd8, 0x33, 0x94, 0x82, 0x12, 0xd6, 0x77,
+	0x1f, 0xa0, 0xde, 0x52, 0x21, 0x35, 0xcb, 0x3a, 0x5d, 0xc9, 0xd5, 0xe5, 0x82, 0x9b, 0x0b, 0x37,
+	0x9e, 0x3e, 0x1b, 0xc7, 0x8f, 0x85, 0x45, 0x40, 0x1b, 0x4b, 0x33, 0x63, 0xbb, 0x2f, 0x7f, 0x42,
+	0x45, 0x0e, 0x35, 0x9e, 0x3f, 0x85, 0xcd, 0xe2, 0xf4, 0xb2, 0xb8, 0xe2, 0xfc, 0x5c, 0xf1, 0xbc,
+	0xb8, 0x16, 0x35, 0xde, 0x4d, 0x46, 0x8d, 0x4a, 0x46, 0xe5, 0xae, 0xd6, 0xca, 0xae, 0xbf, 0xc2,
+	0x83, 0x81, 0x58, 0x26, 0xd5, 0xac, 0xee, 0x2b, 0x6b, 0x79, 0x54, 0xa3, 0x7a, 0x94, 0xff, 0x0e,
+	0xdc, 0x32, 0xdc, 0xc8, 0xfa, 0xdf, 0x55, 0x29, 0xb2, 0x6f, 0xdc, 0x9b, 0xfd, 0xaa, 0xce, 0x3f,
+	0x81, 0x1c, 0x09, 0x99, 0xed, 0x0b, 0xb9, 0x64, 0x32, 0xaa, 0xbc, 0xe0, 0x84, 0x67, 0x4b, 0x21,
+	0x2f, 0x8a, 0x19, 0x64, 0x5c, 0xbd, 0xc2, 0xa2, 0x48, 0x72, 0xa5, 0xcc, 0x10, 0x2a, 0xdc, 0xfb,
+	0x6a, 0xee, 0x7f, 0x0b, 0x5b, 0x2b, 0xbb, 0x97, 0x3d, 0x54, 0x7e, 0x1d, 0x0c, 0xf5, 0x0f, 0x68,
+	0xea, 0x07, 0x99, 0xcf, 0x8a, 0x28, 0xef, 0xf8, 0x16, 0x45, 0x1b, 0xc5, 0xe7, 0x43, 0xbc, 0x81,
+	0xa8, 0xf1, 0x74, 0x45, 0x24, 0x67, 0x4a, 0x24, 0x78, 0xe8, 0xa6, 0xa9, 0x08, 0xbe, 0x6b, 0x84,
+	0xa9, 0x59, 0xfe, 0xee, 0x04, 0xa0, 0x44, 0x89, 0x0b, 0x9d, 0xc9, 0x30, 0x18, 0x8f, 0x4f, 0x83,
+	0xdf, 0x47, 0xd3, 0x60, 0xe0, 0xd6, 0xc8, 0x23, 0x78, 0x38, 0x09, 0x26, 0x93, 0xd1, 0xdb, 0xc3,
+	0x53, 0x1a, 0xbc, 0x1e, 0xef, 0x8d, 0x0e, 0x82, 0x81, 0x5b, 0xd7, 0xc4, 0xd1, 0x60, 0x1c, 0x9c,
+	0x4e, 0x47, 0x07, 0xc1, 0xdb, 0xe3, 0xa9, 0xdb, 0x20, 0xdb, 0xe0, 0xee, 0x0d, 0x0e, 0x46, 0x87,
+	0xa7, 0x7a, 0x7a, 0x8c, 0x0e, 0xf7, 0x74, 0xb8, 0xb5, 0xfb, 0x8f, 0x05, 0xed, 0x29, 0x97, 0x8b,
+	0x58, 0x8b, 0x7a, 0x02, 0xce, 0x90, 0x25, 0x91, 0x9a, 0xb1, 0x0b, 0x4e, 0x2a, 0x5f, 0x84, 0x6e,
+	0xc5, 0x26, 0x4f, 0xc1, 0xde, 0xcb, 0x32, 0x16, 0xce, 0x0c, 0x03, 0xbf, 0x9a, 0xdd, 0x8a, 0xdd,
+	0xab, 0xbf, 0xa8, 0x93, 0x2f, 0xc1, 0xa6, 0xf9, 0x67, 0xac, 0xfc, 0xb6, 0x75, 0x4b, 0x93, 0xfc,
+	0x00, 0x76, 0x3e, 0x9d, 0xc8, 0x3d, 0x9f, 0xb5, 0xee, 0xd6, 0x0a, 0x66, 0x4a, 0xff, 0x5c, 0x97,
+	0x99, 0x87, 0xc4, 0x35, 0xa5, 0xba, 0x99, 0x5a, 0xdd, 0x87, 0x15, 0x24, 0x27, 0xa3, 0x86, 0x97,
+	0x60, 0xe7, 0xed, 0x61, 0xce, 0x58, 0xe9, 0xd4, 0xee, 0xd6, 0x0a, 0x56, 0x09, 0xfb, 0x05, 0xda,
+	0xc5, 0x03, 0x26, 0xdb, 0x48, 0xba, 0xd5, 0x0e, 0xdd, 0x47, 0xb7, 0xd0, 0x3c, 0xf8, 0x45, 0x9d,
+	0x0c, 0x60, 0xbd, 0xf2, 0x68, 0x48, 0x3e, 0xf4, 0xef, 0x3e, 0xd2, 0xae, 0x77, 0x77, 0xa1, 0x14,
+	0x70, 0x66, 0xe3, 0x7f, 0xc9, 0x8f, 0xff, 0x0d, 0x00, 0x4a, 0xd4, 0xb4, 0x46, 0xa7, 0x08, 0x00,
+	0x00,
 }
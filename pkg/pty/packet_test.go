@@ -0,0 +1,58 @@
+package pty
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// bytesMessage is the Bytes message used by clients before Frame
+type bytesMessage struct {
+	Data      []byte    `protobuf:"bytes,1,opt,name=data,proto3"`
+	Completed bool      `protobuf:"varint,2,opt,name=completed,proto3"`
+	Presence  *Presence `protobuf:"bytes,3,opt,name=presence,proto3"`
+	Exit      *Exit     `protobuf:"bytes,4,opt,name=exit,proto3"`
+}
+
+func (m *bytesMessage) Reset()         { *m = bytesMessage{} }
+func (m *bytesMessage) String() string { return proto.CompactTextString(m) }
+func (*bytesMessage) ProtoMessage()    {}
+
+func TestFrameCompatibleWithBytes(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		frame    *Frame
+		expected *bytesMessage
+	}{
+		{"data", dataFrame([]byte("foo")), &bytesMessage{Data: []byte("foo")}},
+		{
+			"presence",
+			&Frame{Frame: &Frame_Presence{Presence: &Presence{Writers: 1, Observers: 2}}},
+			&bytesMessage{Presence: &Presence{Writers: 1, Observers: 2}},
+		},
+		{
+			"exit",
+			&Frame{Frame: &Frame_Exit{Exit: &Exit{Code: 3}}, Completed: true},
+			&bytesMessage{Completed: true, Exit: &Exit{Code: 3}},
+		},
+		{"hello as empty data", &Frame{Frame: &Frame_Hello{Hello: NewHello(ServerCapabilities)}}, &bytesMessage{}},
+		{"keepalive as empty data", &Frame{Frame: &Frame_Keepalive{Keepalive: &Keepalive{Seq: 1, Ack: true}}}, &bytesMessage{}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := proto.Marshal(c.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := &bytesMessage{}
+			if err := proto.Unmarshal(data, actual); err != nil {
+				t.Fatal(err)
+			}
+
+			// unknown fields are dropped
+			if !proto.Equal(actual, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package pty
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// PeerCred is the credential of the process connected to the terminal
+// service, obtained from the unix socket
+type PeerCred struct {
+	Pid int
+	Uid uint32
+	Gid uint32
+}
+
+func (*PeerCred) AuthType() string {
+	return "peercred"
+}
+
+// peerCredentials obtains credential of the peer process during handshake,
+// connections are not encrypted
+type peerCredentials struct{}
+
+func (peerCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("peer credentials are only used by server")
+}
+
+func (peerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	cred, err := getPeerCred(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, cred, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "peercred"}
+}
+
+func (c peerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (peerCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// SetAuthorizer sets the function to check the peer process of every call,
+// cred is nil if not available, calls are rejected if it returns error
+func (t *Terminal) SetAuthorizer(f func(cred *PeerCred) error) {
+	t.mu.Lock()
+	t.authorizer = f
+	t.mu.Unlock()
+}
+
+func (t *Terminal) authorize(ctx context.Context) error {
+	t.mu.Lock()
+	f := t.authorizer
+	t.mu.Unlock()
+
+	if f == nil {
+		return nil
+	}
+
+	var cred *PeerCred
+	if p, ok := peer.FromContext(ctx); ok {
+		cred, _ = p.AuthInfo.(*PeerCred)
+	}
+
+	if err := f(cred); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build linux
+// +build linux
+
+package pty
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// getPeerCred of the unix socket connection, nil for other connections
+func getPeerCred(conn net.Conn) (*PeerCred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil
+	}
+
+	rawConn, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ucred   *unix.Ucred
+		credErr error
+	)
+	if err := rawConn.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+
+	if credErr != nil {
+		return nil, fmt.Errorf("get peer credential failed: %v", credErr)
+	}
+
+	return &PeerCred{Pid: int(ucred.Pid), Uid: ucred.Uid, Gid: ucred.Gid}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package pty
+
+import (
+	"net"
+)
+
+// getPeerCred is not supported, always nil
+func getPeerCred(conn net.Conn) (*PeerCred, error) {
+	return nil, nil
+}
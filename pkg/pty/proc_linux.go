@@ -0,0 +1,258 @@
+//go:build linux
+// +build linux
+
+package pty
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+type process struct {
+	pid       int
+	ppid      int
+	pgrp      int
+	sid       int
+	comm      string
+	startTime uint64
+}
+
+// listProcesses parses all living processes from /proc, zombies are ignored
+func listProcesses() []process {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var procs []process
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+
+		if p, ok := readProcess(pid); ok {
+			procs = append(procs, p)
+		}
+	}
+
+	return procs
+}
+
+// readProcess parses the process from /proc, returns false if the process
+// doesn't exist or is a zombie
+func readProcess(pid int) (process, bool) {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		// process exited
+		return process{}, false
+	}
+
+	return parseProcessStat(pid, string(data))
+}
+
+// parseProcessStat parses content of /proc/<pid>/stat, returns false if
+// malformed or the process is a zombie
+func parseProcessStat(pid int, stat string) (process, bool) {
+	// format: pid (comm) state ppid pgrp session ..., comm may contain any
+	// character including spaces and parentheses
+	start, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return process{}, false
+	}
+
+	// fields start from the 3rd one (state)
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 || fields[0] == "Z" || fields[0] == "X" {
+		return process{}, false
+	}
+
+	ppid, _ := strconv.Atoi(fields[1])
+	pgrp, _ := strconv.Atoi(fields[2])
+	sid, _ := strconv.Atoi(fields[3])
+	startTime, _ := strconv.ParseUint(fields[19], 10, 64)
+	return process{
+		pid:       pid,
+		ppid:      ppid,
+		pgrp:      pgrp,
+		sid:       sid,
+		comm:      stat[start+1 : end],
+		startTime: startTime,
+	}, true
+}
+
+// sessionProcesses finds all processes belong to the session led by sid,
+// including descendants which have left the session (e.g. daemons), but
+// daemons already reparented after leaving the session can not be found
+//
+// the session is identified by sid along with startTime of its leader (if
+// not 0), the pid of the leader can be reused once the leader and all other
+// processes of the session exited, the new process may even lead a new
+// session with the same sid
+func sessionProcesses(sid int, startTime uint64) map[int]process {
+	procs := listProcesses()
+
+	children := make(map[int][]process)
+	result := make(map[int]process)
+	var queue []process
+	for _, p := range procs {
+		if p.pid == sid && startTime != 0 && p.startTime != startTime {
+			// pid reused, the session has gone
+			return nil
+		}
+
+		children[p.ppid] = append(children[p.ppid], p)
+		if p.sid == sid {
+			result[p.pid] = p
+			queue = append(queue, p)
+		}
+	}
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, c := range children[p.pid] {
+			if _, ok := result[c.pid]; !ok {
+				result[c.pid] = c
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	return result
+}
+
+// processStartTime returns start time of the process in clock ticks since
+// boot, 0 if not found
+func processStartTime(pid int) uint64 {
+	p, _ := readProcess(pid)
+	return p.startTime
+}
+
+// waitProcess blocks until the process, which is not a child of us, exited
+func waitProcess(pid int, startTime uint64) {
+	for processStartTime(pid) == startTime {
+		time.Sleep(processPollInterval)
+	}
+}
+
+// signalForeground sends sig to the foreground process group of the terminal,
+// returns pids of processes in the group
+func signalForeground(ptmx *os.File, sig syscall.Signal) ([]int, error) {
+	rawConn, err := ptmx.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	// do not use ptmx.Fd(), which sets the pty master to blocking mode
+	var pgrp int
+	ctrlErr := rawConn.Control(func(fd uintptr) {
+		pgrp, err = unix.IoctlGetInt(int(fd), unix.TIOCGPGRP)
+	})
+	if ctrlErr != nil {
+		return nil, ctrlErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, p := range listProcesses() {
+		if p.pgrp == pgrp {
+			pids = append(pids, p.pid)
+		}
+	}
+
+	if err := unix.Kill(-pgrp, sig); err != nil {
+		return nil, err
+	}
+	return pids, nil
+}
+
+// signalSession sends sig to all processes of the session, returns pids of
+// processes signaled
+func signalSession(sid int, startTime uint64, sig syscall.Signal) ([]int, error) {
+	var pids []int
+	for pid := range sessionProcesses(sid, startTime) {
+		if err := unix.Kill(pid, sig); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// killSession sends SIGHUP to every process of the session, waits at most
+// gracePeriod for them to exit and then SIGKILL all remaining ones, returns
+// all processes signaled
+func killSession(sid int, startTime uint64, gracePeriod time.Duration) []process {
+	signaled := sessionProcesses(sid, startTime)
+	if len(signaled) == 0 {
+		return nil
+	}
+
+	for pid := range signaled {
+		_ = unix.Kill(pid, unix.SIGHUP)
+		// stopped processes won't handle SIGHUP
+		_ = unix.Kill(pid, unix.SIGCONT)
+	}
+
+	deadline := time.Now().Add(gracePeriod)
+	remaining := sessionProcesses(sid, startTime)
+	for len(remaining) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		remaining = sessionProcesses(sid, startTime)
+	}
+
+	for pid, p := range remaining {
+		_ = unix.Kill(pid, unix.SIGKILL)
+		signaled[pid] = p
+	}
+
+	result := make([]process, 0, len(signaled))
+	for _, p := range signaled {
+		result = append(result, p)
+	}
+	return result
+}
+
+// asIdentity runs f in a dedicated os thread whose file system identity is
+// switched to id, so files are accessed with permissions of id, f must not
+// access files in other goroutines
+func asIdentity(id *identity, f func() error) error {
+	if id == nil {
+		return f()
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		// never unlock the thread, it's terminated once the goroutine exited
+		// since its credentials differ from other threads
+		runtime.LockOSThread()
+
+		// these syscalls only apply to the calling thread
+		groups := make([]int, len(id.groups))
+		for i, g := range id.groups {
+			groups[i] = int(g)
+		}
+		if err := unix.Setgroups(groups); err != nil {
+			errCh <- err
+			return
+		}
+		_ = unix.Setfsgid(int(id.gid))
+		_ = unix.Setfsuid(int(id.uid))
+
+		errCh <- f()
+	}()
+
+	return <-errCh
+}
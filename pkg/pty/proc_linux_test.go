@@ -0,0 +1,102 @@
+package pty
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseProcessStat(t *testing.T) {
+	// fields after comm up to starttime (22nd field)
+	const rest = " 1 2 3 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 12345 4096 100"
+
+	for _, c := range []struct {
+		name     string
+		stat     string
+		expected process
+		ok       bool
+	}{
+		{
+			"running",
+			"42 (bash) S" + rest,
+			process{pid: 42, ppid: 1, pgrp: 2, sid: 3, comm: "bash", startTime: 12345},
+			true,
+		},
+		{
+			"comm with spaces and parentheses",
+			"42 (a) (b c) R" + rest,
+			process{pid: 42, ppid: 1, pgrp: 2, sid: 3, comm: "a) (b c", startTime: 12345},
+			true,
+		},
+		{"zombie", "42 (bash) Z" + rest, process{}, false},
+		{"dead", "42 (bash) X" + rest, process{}, false},
+		{"truncated", "42 (bash) S 1 2 3", process{}, false},
+		{"no comm", "42 bash S" + rest, process{}, false},
+		{"empty", "", process{}, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p, ok := parseProcessStat(42, c.stat)
+			if ok != c.ok || p != c.expected {
+				t.Errorf("expected %+v %v, got %+v %v", c.expected, c.ok, p, ok)
+			}
+		})
+	}
+}
+
+func TestKillSession(t *testing.T) {
+	// session leader with a child and a grandchild ignoring SIGHUP
+	cmd := exec.Command("sh", "-c", `sh -c 'trap "" HUP; sleep 60' & sleep 60`)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = cmd.Wait() }()
+
+	sid, startTime := cmd.Process.Pid, processStartTime(cmd.Process.Pid)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sessionProcesses(sid, startTime)) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if procs := sessionProcesses(sid, startTime); len(procs) < 4 {
+		t.Fatalf("expected at least 4 processes in session, got %v", procs)
+	}
+
+	// leader pid reused by another process
+	if signaled := killSession(sid, startTime+1, 200*time.Millisecond); len(signaled) > 0 {
+		t.Fatalf("expected nothing signaled for pid reused, got %v", signaled)
+	}
+
+	signaled := killSession(sid, startTime, 200*time.Millisecond)
+	if len(signaled) < 4 {
+		t.Errorf("expected at least 4 processes signaled, got %v", signaled)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for len(sessionProcesses(sid, startTime)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if procs := sessionProcesses(sid, startTime); len(procs) > 0 {
+		t.Errorf("expected all processes killed, got %v", procs)
+	}
+}
+
+func TestKillSessionLeaderExited(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `sleep 60 & exit 0`)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	sid, startTime := cmd.Process.Pid, processStartTime(cmd.Process.Pid)
+	// leader reaped, its pid is not reused while processes left in the session
+	_ = cmd.Wait()
+
+	if procs := sessionProcesses(sid, startTime); len(procs) != 1 {
+		t.Fatalf("expected process left in session, got %v", procs)
+	}
+
+	if signaled := killSession(sid, startTime, time.Second); len(signaled) != 1 {
+		t.Errorf("expected process left signaled, got %v", signaled)
+	}
+}
@@ -0,0 +1,96 @@
+//go:build !linux
+// +build !linux
+
+package pty
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+type process struct {
+	pid       int
+	ppid      int
+	pgrp      int
+	sid       int
+	comm      string
+	startTime uint64
+}
+
+// processStartTime is not supported on this platform
+func processStartTime(pid int) uint64 {
+	return 0
+}
+
+// waitProcess blocks until the process, which is not a child of us, exited
+func waitProcess(pid int, startTime uint64) {
+	for {
+		p, err := os.FindProcess(pid)
+		if err != nil || p.Signal(syscall.Signal(0)) != nil {
+			return
+		}
+		time.Sleep(processPollInterval)
+	}
+}
+
+// signalForeground is only supported on linux
+func signalForeground(ptmx *os.File, sig syscall.Signal) ([]int, error) {
+	return nil, errors.New("signal not supported")
+}
+
+// signalSession is only supported on linux
+func signalSession(sid int, startTime uint64, sig syscall.Signal) ([]int, error) {
+	return nil, errors.New("signal not supported")
+}
+
+// killSession only kills the session leader since we cannot discover
+// processes of the session on this platform
+func killSession(sid int, startTime uint64, gracePeriod time.Duration) []process {
+	p, err := os.FindProcess(sid)
+	if err != nil {
+		return nil
+	}
+
+	if err := p.Kill(); err != nil {
+		return nil
+	}
+
+	return []process{{pid: sid, sid: sid}}
+}
+
+// startCommand starts cmd as id if not nil, resource limits are only
+// supported on linux
+func startCommand(cmd *exec.Cmd, id *identity, limits Limits) error {
+	if limits != (Limits{}) {
+		return errors.New("resource limits not supported")
+	}
+
+	if id != nil {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = id.credential()
+	}
+
+	return cmd.Start()
+}
+
+// asIdentity is only supported on linux when id is not nil
+func asIdentity(id *identity, f func() error) error {
+	if id != nil {
+		return errors.New("file access as other user not supported")
+	}
+	return f()
+}
+
+// dialAs is only supported on linux when id is not nil
+func dialAs(id *identity, network, address string) (net.Conn, error) {
+	if id != nil {
+		return nil, errors.New("dial as other user not supported")
+	}
+	return net.DialTimeout(network, address, portForwardDialTimeout)
+}
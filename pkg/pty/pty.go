@@ -1,73 +1,790 @@
 package pty
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/kr/pty"
 	"google.golang.org/grpc"
 
 	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
 )
 
 const (
 	defaultUnixShell    = "sh"
 	defaultWindowsShell = "cmd.exe"
+
+	// processPollInterval to check whether an adopted shell has exited
+	processPollInterval = 500 * time.Millisecond
+
+	defaultSocketMode = 0600
+
+	defaultScrollbackSize = 64 * 1024
+	outputChunkSize       = 32 * 1024
+	// outputSinkBufferSize is the count of output chunks buffered for each
+	// attached client, a client falling behind is detached
+	outputSinkBufferSize = 256
+
+	// closeStreamsTimeout is the time to wait for attached clients to
+	// receive the exit event when closing
+	closeStreamsTimeout = 2 * time.Second
+
+	// attachReplyBufferSize is the count of replies to control frames
+	// buffered before reading from the client blocks
+	attachReplyBufferSize = 16
 )
 
+const (
+	// MetadataKeyAttachMode is the grpc metadata key to set attach mode of
+	// Attach and Resize calls
+	MetadataKeyAttachMode = "pty-attach-mode"
+	// AttachModeReadOnly attaches as an observer, input and resize requests
+	// are discarded
+	AttachModeReadOnly = "read-only"
+
+	// MetadataKeyClientVersion is the grpc metadata key set by clients with
+	// their versions in all calls
+	MetadataKeyClientVersion = "pty-client-version"
+	// MetadataKeySessionToken is the grpc metadata key set by clients with
+	// the session token in all calls
+	MetadataKeySessionToken = "pty-session-token"
+)
+
+var (
+	ErrTerminalClosed = errors.New("terminal closed")
+)
+
+// Config of the terminal session
+type Config struct {
+	// Shell to run in the terminal, use system default if empty
+	Shell string
+	// User to run the shell as, either name or uid, run as current user if empty
+	User string
+	// Group is the primary group of the shell, either name or gid, use primary
+	// group of the user if empty
+	Group string
+	// Groups are supplementary groups of the shell, use all groups of the user
+	// if nil
+	Groups []string
+	// LoginShell runs the shell as a login shell in home dir of the user
+	LoginShell bool
+	// Env is extra environment variables of the shell
+	Env map[string]string
+	// Limits are resource limits applied to the shell
+	Limits Limits
+	// KillGracePeriod is the time to wait for processes of the terminal
+	// session to exit after SIGHUP before killing them with SIGKILL
+	KillGracePeriod time.Duration
+	// ScrollbackSize is the size in bytes of recent output replayed to
+	// clients on attach, use 64KiB if 0
+	ScrollbackSize int
+	// IdleTimeout closes the session if there is no input from any client
+	// for this long, disabled if 0
+	IdleTimeout time.Duration
+	// MinClientVersion rejects clients older than this version, clients not
+	// reporting version are rejected as well, disabled if empty
+	MinClientVersion string
+	// SocketMode is the permission bits of the unix socket and its dir
+	// (execute bits added along with read ones), use 0600 if 0
+	SocketMode os.FileMode
+	// SocketOwner of the unix socket and its dir in form of [user][:group],
+	// owned by current user if empty
+	SocketOwner string
+}
+
 type Terminal struct {
 	ptmx      *os.File
-	cmd       *exec.Cmd
+	pid       int
 	completed uint32
+	doneCh    chan struct{}
+	config    Config
+	closeOnce sync.Once
+	startTime uint64
+
+	srv      *grpc.Server
+	closed   bool
+	released bool
+	mu       sync.Mutex
+
+	attached       int32
+	observers      int32
+	onAttachChange func(attached int)
+
+	// counters since the terminal created
+	attaches    uint64
+	inputBytes  uint64
+	outputBytes uint64
+
+	// output of the pty is read by a single pump, kept in scrollback and
+	// delivered to all attached clients
+	scrollback *ringBuffer
+	sinks      map[*outputSink]struct{}
+	outputDone chan struct{}
+
+	// serialize input from all attached clients
+	inputMu sync.Mutex
+	// lastInput is the unix nano time of last input
+	lastInput int64
+
+	// exit is available once the shell exited, closeReason is the reason
+	// reported if closed before the shell exited
+	exit        *Exit
+	closeReason ExitReason
+
+	recorder    Recorder
+	recordInput bool
+
+	authorizer func(cred *PeerCred) error
+	token      string
+}
+
+// Recorder records what happened in the terminal
+type Recorder interface {
+	Output(data []byte) error
+	Input(data []byte) error
+	Resize(cols, rows uint16) error
+}
+
+// outputSink receives pty output for an attached client
+type outputSink struct {
+	ch              chan []byte
+	detached        chan struct{}
+	presenceChanged chan struct{}
 }
 
 func (t *Terminal) Completed() bool {
 	return atomic.LoadUint32(&t.completed) == 1
 }
 
+// Done returns a channel which will be closed once the shell process exited
+func (t *Terminal) Done() <-chan struct{} {
+	return t.doneCh
+}
+
+// Pid of the shell process, which is also the session id of the terminal
+func (t *Terminal) Pid() int {
+	return t.pid
+}
+
+// StartTime of the shell process in clock ticks since boot, used to detect
+// pid reuse, 0 if unknown
+func (t *Terminal) StartTime() uint64 {
+	return t.startTime
+}
+
+// Attached returns count of clients currently attached, including observers
+func (t *Terminal) Attached() int {
+	return int(atomic.LoadInt32(&t.attached))
+}
+
+// Observers returns count of clients currently attached in read-only mode
+func (t *Terminal) Observers() int {
+	return int(atomic.LoadInt32(&t.observers))
+}
+
+// Stats of the terminal since created
+type Stats struct {
+	// Attaches is the count of clients ever attached, including observers
+	Attaches    uint64
+	InputBytes  uint64
+	OutputBytes uint64
+}
+
+func (t *Terminal) Stats() Stats {
+	return Stats{
+		Attaches:    atomic.LoadUint64(&t.attaches),
+		InputBytes:  atomic.LoadUint64(&t.inputBytes),
+		OutputBytes: atomic.LoadUint64(&t.outputBytes),
+	}
+}
+
+func (t *Terminal) presence() *Presence {
+	observers := t.Observers()
+	return &Presence{Writers: uint32(t.Attached() - observers), Observers: uint32(observers)}
+}
+
+// OnAttachChange sets the function to be called with current attached client
+// count whenever a client attached or detached
+func (t *Terminal) OnAttachChange(f func(attached int)) {
+	t.mu.Lock()
+	t.onAttachChange = f
+	t.mu.Unlock()
+}
+
+func (t *Terminal) addAttached(delta int32, readOnly bool) {
+	if delta > 0 {
+		atomic.AddUint64(&t.attaches, uint64(delta))
+	}
+	if readOnly {
+		atomic.AddInt32(&t.observers, delta)
+	}
+	n := atomic.AddInt32(&t.attached, delta)
+
+	t.mu.Lock()
+	f := t.onAttachChange
+	for sink := range t.sinks {
+		select {
+		case sink.presenceChanged <- struct{}{}:
+		default:
+		}
+	}
+	t.mu.Unlock()
+
+	if f != nil {
+		f(int(n))
+	}
+}
+
+// File returns the pty master, used to hand the terminal over to another
+// process
+func (t *Terminal) File() *os.File {
+	return t.ptmx
+}
+
+// Released returns true if the terminal has been released
+func (t *Terminal) Released() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.released
+}
+
+// Scrollback returns a copy of recent output of the terminal
+func (t *Terminal) Scrollback() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.scrollback.Bytes()
+}
+
+// subscribe adds a sink to receive pty output, output before subscribing is
+// returned as scrollback, so nothing is lost or duplicated
+func (t *Terminal) subscribe() (*outputSink, []byte) {
+	sink := &outputSink{
+		ch:              make(chan []byte, outputSinkBufferSize),
+		detached:        make(chan struct{}),
+		presenceChanged: make(chan struct{}, 1),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sinks[sink] = struct{}{}
+	return sink, t.scrollback.Bytes()
+}
+
+func (t *Terminal) unsubscribe(sink *outputSink) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.detachLocked(sink)
+}
+
+func (t *Terminal) detachLocked(sink *outputSink) {
+	if _, ok := t.sinks[sink]; ok {
+		close(sink.detached)
+		delete(t.sinks, sink)
+	}
+}
+
+// pump reads pty output until the pty closed, output is kept in scrollback
+// and delivered to all attached clients
+func (t *Terminal) pump() {
+	defer close(t.outputDone)
+
+	buf := make([]byte, outputChunkSize)
+	for {
+		n, err := t.ptmx.Read(buf)
+		if n > 0 {
+			atomic.AddUint64(&t.outputBytes, uint64(n))
+			data := make([]byte, n)
+			copy(data, buf[:n])
+
+			t.mu.Lock()
+			t.scrollback.Write(data)
+			if t.recorder != nil {
+				if err := t.recorder.Output(data); err != nil {
+					log.E("record output failed", log.Err(err))
+				}
+			}
+			for sink := range t.sinks {
+				select {
+				case sink.ch <- data:
+				default:
+					// never block others, the client can attach again to
+					// get scrollback
+					log.I("client falling behind, detach")
+					t.detachLocked(sink)
+				}
+			}
+			t.mu.Unlock()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeInput writes user input to the pty, input from different clients are
+// never interleaved
+func (t *Terminal) writeInput(data []byte) error {
+	t.inputMu.Lock()
+	defer t.inputMu.Unlock()
+
+	atomic.StoreInt64(&t.lastInput, time.Now().UnixNano())
+	atomic.AddUint64(&t.inputBytes, uint64(len(data)))
+	if r, recordInput := t.getRecorder(); r != nil && recordInput {
+		if err := r.Input(data); err != nil {
+			log.E("record input failed", log.Err(err))
+		}
+	}
+
+	for len(data) > 0 {
+		n, err := t.ptmx.Write(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
 func (t *Terminal) ResizePty(cols, rows uint16) error {
-	return pty.Setsize(t.ptmx, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+	if err := pty.Setsize(t.ptmx, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)}); err != nil {
+		return err
+	}
+
+	if r, _ := t.getRecorder(); r != nil {
+		if err := r.Resize(cols, rows); err != nil {
+			log.E("record resize failed", log.Err(err))
+		}
+	}
+	return nil
+}
+
+// Size returns current size of the pty
+func (t *Terminal) Size() (cols, rows uint16, err error) {
+	size, err := pty.GetsizeFull(t.ptmx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return size.Cols, size.Rows, nil
+}
+
+// Record records output and resize of the terminal with r from now on, input
+// is recorded as well if recordInput, output before (i.e. scrollback) is
+// recorded first if withScrollback, nil r stops recording
+func (t *Terminal) Record(r Recorder, recordInput, withScrollback bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if r != nil && withScrollback {
+		if data := t.scrollback.Bytes(); len(data) > 0 {
+			if err := r.Output(data); err != nil {
+				log.E("record output failed", log.Err(err))
+			}
+		}
+	}
+
+	t.recorder, t.recordInput = r, recordInput
 }
 
+func (t *Terminal) getRecorder() (Recorder, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.recorder, t.recordInput
+}
+
+// SendSignal sends sig to the foreground process group of the terminal, or all
+// processes in the session, returns pids of processes signaled
+func (t *Terminal) SendSignal(sig syscall.Signal, session bool) ([]int, error) {
+	if t.Completed() {
+		return nil, ErrTerminalClosed
+	}
+
+	if session {
+		return signalSession(t.Pid(), t.StartTime(), sig)
+	}
+	return signalForeground(t.ptmx, sig)
+}
+
+// Exit returns exit status of the shell, nil if not exited
+func (t *Terminal) Exit() *Exit {
+	select {
+	case <-t.doneCh:
+		return t.exit
+	default:
+		return nil
+	}
+}
+
+// Close terminates all processes in the shell session even if the shell
+// itself has exited, and stops the terminal service after attached clients
+// notified, it blocks until processes exited or killed
 func (t *Terminal) Close() error {
+	return t.CloseWithReason(ExitReason_SESSION_RECLAIMED)
+}
+
+// CloseWithReason is the same as Close, the reason is reported to attached
+// clients if the shell is still running
+func (t *Terminal) CloseWithReason(reason ExitReason) error {
+	t.mu.Lock()
+	if !t.closed && !t.Completed() {
+		t.closeReason = reason
+	}
+	t.closed = true
+	srv := t.srv
+	t.mu.Unlock()
+
+	t.closeOnce.Do(func() {
+		// shell was started as session leader, its pid may have been reused
+		// if it has been reaped
+		logReaped(t.Pid(), killSession(t.Pid(), t.StartTime(), t.config.KillGracePeriod))
+	})
+
+	if srv != nil {
+		// wait for attached clients to receive exit event
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(closeStreamsTimeout):
+			srv.Stop()
+		}
+	}
+
 	if !t.Completed() {
-		_ = t.cmd.Process.Kill()
 		return t.ptmx.Close()
 	}
 
 	return nil
 }
 
+// Release stops the terminal service and closes the pty master, but leaves
+// processes of the shell session running, used after the terminal has been
+// handed over to another process
+func (t *Terminal) Release() error {
+	t.mu.Lock()
+	t.closed = true
+	t.released = true
+	srv := t.srv
+	t.mu.Unlock()
+
+	// never kill the session once released
+	t.closeOnce.Do(func() {})
+
+	if srv != nil {
+		srv.Stop()
+	}
+
+	return t.ptmx.Close()
+}
+
 func (t *Terminal) ListenAndServe(addr string) error {
-	srv := grpc.NewServer([]grpc.ServerOption{}...)
+	srv := grpc.NewServer(
+		grpc.Creds(peerCredentials{}),
+		grpc.UnaryInterceptor(t.unaryInterceptor),
+		grpc.StreamInterceptor(t.streamInterceptor),
+	)
 	RegisterTerminalServer(srv, t)
 
-	return util.GRPCListenAndServe(srv, "unix", addr)
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrTerminalClosed
+	}
+	t.srv = srv
+	t.mu.Unlock()
+
+	l, err := util.Listen("unix", addr)
+	if err != nil {
+		return err
+	}
+
+	if err := t.config.protectSocket(addr); err != nil {
+		_ = l.Close()
+		return fmt.Errorf("set permissions of socket failed: %v", err)
+	}
+
+	if err := t.writeTokenFile(addr); err != nil {
+		_ = l.Close()
+		return fmt.Errorf("write session token file failed: %v", err)
+	}
+
+	return srv.Serve(l)
 }
 
-func Open(shell string, cols, rows uint16) (*Terminal, error) {
-	if shell == "" {
-		switch runtime.GOOS {
-		case "windows":
-			shell = defaultWindowsShell
-		default:
-			shell = defaultUnixShell
-		}
+// protectSocket sets permissions and owner of the socket and its dir
+func (c Config) protectSocket(addr string) error {
+	mode := c.socketMode()
+	dir := filepath.Dir(addr)
+	// dir is searchable by whom can read the socket
+	if err := os.Chmod(dir, mode|(mode&0444)>>2); err != nil {
+		return err
+	}
+
+	if err := c.chownSocket(dir); err != nil {
+		return err
+	}
+
+	return c.protectFile(addr)
+}
+
+// protectFile sets permissions and owner of the file the same as the socket
+func (c Config) protectFile(file string) error {
+	if err := os.Chmod(file, c.socketMode()); err != nil {
+		return err
+	}
+
+	return c.chownSocket(file)
+}
+
+func (c Config) socketMode() os.FileMode {
+	if mode := c.SocketMode.Perm(); mode != 0 {
+		return mode
+	}
+	return defaultSocketMode
+}
+
+func (c Config) chownSocket(file string) error {
+	uid, gid, err := lookupOwner(c.SocketOwner)
+	if err != nil || (uid == -1 && gid == -1) {
+		return err
+	}
+
+	return os.Chown(file, uid, gid)
+}
+
+// KillOrphanSession terminates processes left in the session of a shell
+// which is no longer managed by any terminal (e.g. started before restart),
+// nothing is done if the pid has been reused by another process
+func KillOrphanSession(sid int, startTime uint64, gracePeriod time.Duration) {
+	if current := processStartTime(sid); current != 0 && current != startTime {
+		log.I("session leader pid reused, skip killing orphan session", log.Int("sid", sid))
+		return
+	}
+
+	logReaped(sid, killSession(sid, startTime, gracePeriod))
+}
+
+func logReaped(sid int, reaped []process) {
+	if len(reaped) == 0 {
+		return
+	}
+
+	pids := make([]int, len(reaped))
+	commands := make([]string, len(reaped))
+	for i, p := range reaped {
+		pids[i], commands[i] = p.pid, p.comm
+	}
+	log.I("reaped session processes", log.Int("sid", sid), log.Ints("pids", pids), log.Strings("commands", commands))
+}
+
+func Open(config Config, cols, rows uint16) (*Terminal, error) {
+	shell := config.shell()
+	cmd, id, err := newCommand(config, shell)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.LoginShell {
+		// login shell is indicated by a leading dash in argv[0]
+		cmd.Args[0] = "-" + filepath.Base(shell)
 	}
 
-	cmd := exec.Command(shell)
-	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: cols, Rows: rows})
+	ptmx, tty, err := pty.Open()
 	if err != nil {
 		return nil, err
 	}
+	defer func() { _ = tty.Close() }()
+
+	if err := pty.Setsize(ptmx, &pty.Winsize{Cols: cols, Rows: rows}); err != nil {
+		_ = ptmx.Close()
+		return nil, err
+	}
+
+	if id != nil {
+		// programs reopen the terminal (e.g. password prompt) need to own it
+		if err := tty.Chown(int(id.uid), int(id.gid)); err != nil {
+			_ = ptmx.Close()
+			return nil, err
+		}
+	}
 
-	term := &Terminal{ptmx: ptmx, cmd: cmd}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+
+	if err := startCommand(cmd, id, config.Limits); err != nil {
+		_ = ptmx.Close()
+		return nil, err
+	}
+
+	term := newTerminal(config, ptmx, cmd.Process.Pid, processStartTime(cmd.Process.Pid), nil)
 	go func() {
 		_ = cmd.Wait()
-		atomic.StoreUint32(&term.completed, 1)
-		_ = ptmx.Close()
+		term.setExited(cmd.ProcessState)
+	}()
+
+	return term, nil
+}
+
+func (c Config) shell() string {
+	if c.Shell != "" {
+		return c.Shell
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return defaultWindowsShell
+	default:
+		return defaultUnixShell
+	}
+}
+
+// newCommand creates a command with environment variables of the user and
+// configured, a login session starts in home dir, the command should be
+// started by startCommand to run as the user
+func newCommand(config Config, name string, args ...string) (*exec.Cmd, *identity, error) {
+	cmd := exec.Command(name, args...)
+
+	id, err := config.identity()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if id != nil {
+		shellPath, err := exec.LookPath(config.shell())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cmd.Env = id.environ(shellPath)
+	}
+
+	if len(config.Env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+
+		for k, v := range config.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+
+	if config.LoginShell {
+		cmd.Dir = id.home
+		if info, err := os.Stat(id.home); err != nil || !info.IsDir() {
+			// same as login(1), start at root dir if home not available
+			cmd.Dir = "/"
+		}
+	}
+
+	return cmd, id, nil
+}
+
+func newTerminal(config Config, ptmx *os.File, pid int, startTime uint64, scrollback []byte) *Terminal {
+	scrollbackSize := config.ScrollbackSize
+	if scrollbackSize == 0 {
+		scrollbackSize = defaultScrollbackSize
+	}
+
+	t := &Terminal{
+		ptmx:       ptmx,
+		pid:        pid,
+		doneCh:     make(chan struct{}),
+		config:     config,
+		startTime:  startTime,
+		scrollback: newRingBuffer(scrollbackSize),
+		sinks:      make(map[*outputSink]struct{}),
+		outputDone: make(chan struct{}),
+	}
+	t.scrollback.Write(scrollback)
+	t.lastInput = time.Now().UnixNano()
+
+	go t.pump()
+	if config.IdleTimeout > 0 {
+		go t.closeWhenIdle()
+	}
+	return t
+}
+
+// setExited records exit status of the shell and releases the pty master
+func (t *Terminal) setExited(state *os.ProcessState) {
+	exit := exitStatus(state)
+
+	t.mu.Lock()
+	exit.Reason = t.closeReason
+	t.exit = exit
+	t.mu.Unlock()
+
+	atomic.StoreUint32(&t.completed, 1)
+	_ = t.ptmx.Close()
+	close(t.doneCh)
+}
+
+// exitStatus of the process, exit code is -1 if unknown
+func exitStatus(state *os.ProcessState) *Exit {
+	exit := &Exit{Code: -1}
+	if state != nil {
+		exit.Code = int32(state.ExitCode())
+		if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			exit.Signal = int32(ws.Signal())
+		}
+	}
+	return exit
+}
+
+// closeWhenIdle closes the terminal once there is no input for idle timeout
+func (t *Terminal) closeWhenIdle() {
+	for {
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&t.lastInput)))
+		if idle >= t.config.IdleTimeout {
+			log.I("close idle terminal", log.Int("pid", t.Pid()), log.Duration("idle", idle))
+			_ = t.CloseWithReason(ExitReason_IDLE_TIMEOUT)
+			return
+		}
+
+		select {
+		case <-t.doneCh:
+			return
+		case <-time.After(t.config.IdleTimeout - idle):
+		}
+	}
+}
+
+// Adopt creates a terminal with the pty master and shell process of another
+// terminal handed over from another process (e.g. during graceful upgrade),
+// the shell is not our child, so its exit is detected by polling, scrollback
+// is the recent output of the previous terminal
+func Adopt(config Config, ptmx *os.File, pid int, startTime uint64, scrollback []byte) (*Terminal, error) {
+	if processStartTime(pid) != startTime {
+		return nil, fmt.Errorf("shell process %d not found", pid)
+	}
+
+	term := newTerminal(config, ptmx, pid, startTime, scrollback)
+	go func() {
+		waitProcess(pid, startTime)
+		// exit status of a process not our child is unknown
+		term.setExited(nil)
 	}()
 
 	return term, nil
@@ -0,0 +1,49 @@
+package pty
+
+// ringBuffer keeps the most recent bytes written up to its capacity, it's not
+// safe for concurrent use
+type ringBuffer struct {
+	buf   []byte
+	start int
+	size  int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{buf: make([]byte, capacity)}
+}
+
+func (r *ringBuffer) Write(p []byte) {
+	capacity := len(r.buf)
+	if capacity == 0 {
+		return
+	}
+
+	if len(p) >= capacity {
+		copy(r.buf, p[len(p)-capacity:])
+		r.start, r.size = 0, capacity
+		return
+	}
+
+	end := (r.start + r.size) % capacity
+	n := copy(r.buf[end:], p)
+	copy(r.buf, p[n:])
+
+	r.size += len(p)
+	if r.size > capacity {
+		r.start = (r.start + r.size - capacity) % capacity
+		r.size = capacity
+	}
+}
+
+// Bytes returns a copy of buffered bytes
+func (r *ringBuffer) Bytes() []byte {
+	data := make([]byte, r.size)
+	end := r.start + r.size
+	if end > len(r.buf) {
+		end = len(r.buf)
+	}
+
+	n := copy(data, r.buf[r.start:end])
+	copy(data[n:], r.buf)
+	return data
+}
@@ -0,0 +1,45 @@
+package pty
+
+import (
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		capacity int
+		writes   []string
+		expected string
+	}{
+		{"empty", 4, nil, ""},
+		{"zero capacity", 0, []string{"abc"}, ""},
+		{"not full", 4, []string{"ab"}, "ab"},
+		{"full", 4, []string{"ab", "cd"}, "abcd"},
+		{"overwrite", 4, []string{"abc", "de"}, "bcde"},
+		{"wrap around", 4, []string{"abc", "de", "fg"}, "defg"},
+		{"write larger than capacity", 4, []string{"a", "bcdefg"}, "defg"},
+		{"many small writes", 3, []string{"a", "b", "c", "d", "e"}, "cde"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := newRingBuffer(c.capacity)
+			for _, w := range c.writes {
+				r.Write([]byte(w))
+			}
+
+			if actual := string(r.Bytes()); actual != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRingBufferBytesIsCopy(t *testing.T) {
+	r := newRingBuffer(4)
+	r.Write([]byte("abcd"))
+
+	data := r.Bytes()
+	data[0] = 'x'
+	if actual := string(r.Bytes()); actual != "abcd" {
+		t.Errorf("buffer modified through returned bytes: %q", actual)
+	}
+}
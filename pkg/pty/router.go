@@ -0,0 +1,134 @@
+package pty
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+const (
+	// MetadataKeyResourceName and MetadataKeyDevice are the grpc metadata
+	// keys to select the terminal in calls to a router
+	MetadataKeyResourceName = "pty-resource-name"
+	MetadataKeyDevice       = "pty-device"
+)
+
+// TerminalLookup finds the terminal of the device, the error returned is
+// sent to the client
+type TerminalLookup func(ctx context.Context, resourceName, deviceID string) (*Terminal, error)
+
+// NewRouter creates a grpc server serving Terminal calls of all terminals
+// found by lookup, the terminal is selected by metadata of every call
+func NewRouter(lookup TerminalLookup, opts ...grpc.ServerOption) *grpc.Server {
+	r := &router{lookup: lookup}
+	srv := grpc.NewServer(append(opts,
+		grpc.UnaryInterceptor(r.unaryInterceptor),
+		grpc.StreamInterceptor(r.streamInterceptor),
+	)...)
+	RegisterTerminalServer(srv, r)
+	return srv
+}
+
+type router struct {
+	lookup TerminalLookup
+}
+
+type terminalKey struct{}
+
+// terminal selected by the interceptor
+func terminal(ctx context.Context) *Terminal {
+	return ctx.Value(terminalKey{}).(*Terminal)
+}
+
+// route finds the terminal of the call and checks the client version, the
+// terminal is stored in returned context
+func (r *router) route(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var resourceName, deviceID string
+	if v := md.Get(MetadataKeyResourceName); len(v) > 0 {
+		resourceName = v[0]
+	}
+	if v := md.Get(MetadataKeyDevice); len(v) > 0 {
+		deviceID = v[0]
+	}
+
+	if deviceID == "" {
+		return nil, status.Error(codes.InvalidArgument, "device not specified")
+	}
+
+	t, err := r.lookup(ctx, resourceName, deviceID)
+	if err == nil {
+		err = t.checkClientVersion(ctx)
+	}
+	if err != nil {
+		log.I("client rejected", log.String("method", method),
+			log.String("resource_name", resourceName), log.String("device", deviceID), log.Err(err))
+		return nil, err
+	}
+
+	return context.WithValue(ctx, terminalKey{}, t), nil
+}
+
+func (r *router) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := r.route(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (r *router) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := r.route(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &routedStream{ServerStream: ss, ctx: ctx})
+}
+
+// routedStream carries the terminal selected in its context
+type routedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *routedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (r *router) Handshake(ctx context.Context, req *Hello) (*Hello, error) {
+	return terminal(ctx).Handshake(ctx, req)
+}
+
+func (r *router) Attach(srv Terminal_AttachServer) error {
+	return terminal(srv.Context()).Attach(srv)
+}
+
+func (r *router) Resize(ctx context.Context, req *Size) (*Size, error) {
+	return terminal(ctx).Resize(ctx, req)
+}
+
+func (r *router) Signal(ctx context.Context, req *SignalRequest) (*SignalResponse, error) {
+	return terminal(ctx).Signal(ctx, req)
+}
+
+func (r *router) Exec(srv Terminal_ExecServer) error {
+	return terminal(srv.Context()).Exec(srv)
+}
+
+func (r *router) Upload(srv Terminal_UploadServer) error {
+	return terminal(srv.Context()).Upload(srv)
+}
+
+func (r *router) Download(req *DownloadRequest, srv Terminal_DownloadServer) error {
+	return terminal(srv.Context()).Download(req, srv)
+}
+
+func (r *router) PortForward(srv Terminal_PortForwardServer) error {
+	return terminal(srv.Context()).PortForward(srv)
+}
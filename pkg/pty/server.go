@@ -1,106 +1,227 @@
 package pty
 
 import (
-	"bufio"
 	"context"
+	"syscall"
 
 	"github.com/kr/pty"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"arhat.dev/kube-host-pty/pkg/util"
 	"arhat.dev/kube-host-pty/pkg/util/log"
 )
 
+// Attach streams recent output as scrollback and then live output of the
+// terminal to the client, any number of clients can attach at the same time
+// sharing the same output, and input from all of them is merged, the session
+// keeps running after all clients detached
+//
+// clients attached in read-only mode only receive output, clients are
+// notified with count of writers and observers whenever it changed
+//
+// control frames are handled in order with input, replies to them are sent
+// along with output
 func (t *Terminal) Attach(srv Terminal_AttachServer) error {
-	recvCh := make(chan []byte, 1)
-	sendCh := make(chan []byte, 1)
+	readOnly := isReadOnly(srv.Context())
+
+	sink, scrollback := t.subscribe()
+	defer t.unsubscribe(sink)
+
+	t.addAttached(1, readOnly)
+	defer t.addAttached(-1, readOnly)
 
 	ctx, exit := context.WithCancel(srv.Context())
+	defer exit()
 
+	replyCh := make(chan *Frame, attachReplyBufferSize)
 	util.Workers.Add(func(func()) (interface{}, error) {
-		defer close(sendCh)
+		defer exit()
 
-		// read pty output
-		s := bufio.NewScanner(t.ptmx)
-		s.Split(util.ScanAnyAvail)
-
-		for s.Scan() {
-			ptyOutput := s.Bytes()
-			select {
-			case <-ctx.Done():
+		// read user input and control frames
+		for {
+			frame, err := srv.Recv()
+			if err != nil {
 				return nil, nil
-			case sendCh <- ptyOutput:
-				// continue
 			}
-		}
-		return nil, nil
-	}, func(func()) (interface{}, error) {
-		defer close(recvCh)
 
-		// read user input
-		for {
-			inputPacket, err := srv.Recv()
-			if err != nil {
-				return nil, err
+			var reply *Frame
+			switch f := frame.GetFrame().(type) {
+			case *Frame_Data:
+				if readOnly {
+					continue
+				}
+
+				if err := t.writeInput(f.Data); err != nil {
+					log.E("write user input to pty failed", log.Err(err))
+					return nil, err
+				}
+			case *Frame_Resize:
+				reply = &Frame{Frame: &Frame_Resize{Resize: t.resize(readOnly, f.Resize)}}
+			case *Frame_Signal:
+				// no reply, result is logged
+				_, _ = t.signal(readOnly, f.Signal)
+			case *Frame_Hello:
+				log.I("client attached", log.Bool("read_only", readOnly),
+					log.String("version", f.Hello.GetVersion()), log.String("commit", f.Hello.GetCommit()))
+			case *Frame_Keepalive:
+				if !f.Keepalive.GetAck() {
+					reply = &Frame{Frame: &Frame_Keepalive{Keepalive: &Keepalive{Seq: f.Keepalive.GetSeq(), Ack: true}}}
+				}
+			}
+
+			if reply == nil {
+				continue
 			}
 
-			userInput := inputPacket.GetData()
 			select {
+			case replyCh <- reply:
 			case <-ctx.Done():
 				return nil, nil
-			case recvCh <- userInput:
-				// continue
 			}
 		}
 	})
 
-	defer exit()
+	if err := srv.Send(&Frame{Frame: &Frame_Hello{Hello: NewHello(ServerCapabilities)}}); err != nil {
+		log.E("send hello to user failed", log.Err(err))
+		return err
+	}
+
+	if len(scrollback) > 0 {
+		if err := srv.Send(dataFrame(scrollback)); err != nil {
+			log.E("send scrollback to user failed", log.Err(err))
+			return err
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case ptyOutput, more := <-sendCh:
-			if !more {
-				return nil
+		case <-sink.detached:
+			return status.Error(codes.ResourceExhausted, "client falling behind pty output")
+		case <-t.outputDone:
+			// pump has finished, flush output buffered
+			for len(sink.ch) > 0 {
+				if err := srv.Send(dataFrame(<-sink.ch)); err != nil {
+					return err
+				}
 			}
 
-			completed := t.Completed()
-			err := srv.Send(&Bytes{Data: ptyOutput, Completed: completed})
-			if err != nil {
-				log.E("send pty output to user failed", log.Err(err))
-				return err
+			if t.Released() {
+				// handed over, let client attach to the new process
+				return status.Error(codes.Unavailable, ErrTerminalClosed.Error())
 			}
 
-			if completed {
-				return nil
-			}
-		case userInput, more := <-recvCh:
-			if !more {
+			// pty closed after shell exited in most cases, but the shell may
+			// also close the terminal by itself
+			select {
+			case <-t.Done():
+			case <-ctx.Done():
 				return nil
 			}
 
-			for len(userInput) > 0 {
-				n, err := t.ptmx.Write(userInput)
-				if err != nil {
-					log.E("write user input to pty failed", log.Err(err))
-					return err
-				}
-				userInput = userInput[n:]
+			return srv.Send(&Frame{Frame: &Frame_Exit{Exit: t.Exit()}, Completed: true})
+		case <-sink.presenceChanged:
+			// sent regardless of hello, it's wire compatible with Bytes
+			if err := srv.Send(&Frame{Frame: &Frame_Presence{Presence: t.presence()}}); err != nil {
+				log.E("send presence to user failed", log.Err(err))
+				return err
+			}
+		case reply := <-replyCh:
+			if err := srv.Send(reply); err != nil {
+				log.E("send reply to user failed", log.Err(err))
+				return err
+			}
+		case ptyOutput := <-sink.ch:
+			if err := srv.Send(dataFrame(ptyOutput)); err != nil {
+				log.E("send pty output to user failed", log.Err(err))
+				return err
 			}
 		}
 	}
 }
 
+func dataFrame(data []byte) *Frame {
+	return &Frame{Frame: &Frame_Data{Data: data}}
+}
+
 func (t *Terminal) Resize(ctx context.Context, req *Size) (*Size, error) {
-	if err := t.ResizePty(uint16(req.Cols), uint16(req.Rows)); err != nil {
-		log.E("resize pty failed", log.Uint32("cols", req.GetCols()), log.Uint32("rows", req.GetRows()), log.Err(err))
-		return &Size{}, nil
+	return t.resize(isReadOnly(ctx), req), nil
+}
+
+// resize the terminal and returns current size, observers never change the
+// size, zero size is returned on error
+func (t *Terminal) resize(readOnly bool, req *Size) *Size {
+	if !readOnly {
+		if err := t.ResizePty(uint16(req.GetCols()), uint16(req.GetRows())); err != nil {
+			log.E("resize pty failed", log.Uint32("cols", req.GetCols()), log.Uint32("rows", req.GetRows()), log.Err(err))
+			return &Size{}
+		}
 	}
 
 	// return current pty size
-	if rows, cols, err := pty.Getsize(t.ptmx); err != nil {
-		log.E("resize pty failed", log.Uint32("cols", req.GetCols()), log.Uint32("rows", req.GetRows()), log.Err(err))
-		return &Size{}, nil
-	} else {
-		return &Size{Rows: uint32(rows), Cols: uint32(cols)}, nil
+	rows, cols, err := pty.Getsize(t.ptmx)
+	if err != nil {
+		log.E("get pty size failed", log.Err(err))
+		return &Size{}
+	}
+	return &Size{Rows: uint32(rows), Cols: uint32(cols)}
+}
+
+var signals = map[SignalRequest_Name]syscall.Signal{
+	SignalRequest_INT:  syscall.SIGINT,
+	SignalRequest_TERM: syscall.SIGTERM,
+	SignalRequest_KILL: syscall.SIGKILL,
+	SignalRequest_QUIT: syscall.SIGQUIT,
+	SignalRequest_TSTP: syscall.SIGTSTP,
+}
+
+func (t *Terminal) Signal(ctx context.Context, req *SignalRequest) (*SignalResponse, error) {
+	pids, err := t.signal(isReadOnly(ctx), req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SignalResponse{}
+	for _, pid := range pids {
+		resp.Pids = append(resp.Pids, int32(pid))
+	}
+	return resp, nil
+}
+
+// signal processes of the terminal as requested, returns pids signaled
+func (t *Terminal) signal(readOnly bool, req *SignalRequest) ([]int, error) {
+	if readOnly {
+		return nil, status.Error(codes.PermissionDenied, "observers can not send signal")
+	}
+
+	sig, ok := signals[req.GetName()]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported signal %v", req.GetName())
+	}
+
+	pids, err := t.SendSignal(sig, req.GetSession())
+	if err != nil {
+		log.E("send signal failed", log.String("signal", sig.String()), log.Err(err))
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	log.I("signal sent", log.String("signal", sig.String()), log.Bool("session", req.GetSession()), log.Ints("pids", pids))
+	return pids, nil
+}
+
+func isReadOnly(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, mode := range md.Get(MetadataKeyAttachMode) {
+		if mode == AttachModeReadOnly {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,96 @@
+package pty
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// TokenFileSuffix is appended to the socket path as path of the file
+	// containing the session token
+	TokenFileSuffix = ".token"
+
+	tokenSize = 32
+)
+
+// NewToken generates a random session token
+func NewToken() (string, error) {
+	buf := make([]byte, tokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ReadTokenFile returns the session token in the file
+func ReadTokenFile(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SetToken requires all calls to present the token, and writes it to the
+// token file along with the socket once served, empty to disable
+func (t *Terminal) SetToken(token string) {
+	t.mu.Lock()
+	t.token = token
+	t.mu.Unlock()
+}
+
+// writeTokenFile next to the socket with the same permissions
+func (t *Terminal) writeTokenFile(addr string) error {
+	t.mu.Lock()
+	token := t.token
+	t.mu.Unlock()
+
+	if token == "" {
+		return nil
+	}
+
+	file := addr + TokenFileSuffix
+	tmpFile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, []byte(token+"\n"), 0600); err != nil {
+		return err
+	}
+
+	if err := t.config.protectFile(tmpFile); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+
+	// never leave a partial token to clients
+	return os.Rename(tmpFile, file)
+}
+
+func (t *Terminal) checkToken(ctx context.Context) error {
+	t.mu.Lock()
+	token := t.token
+	t.mu.Unlock()
+
+	if token == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get(MetadataKeySessionToken)
+	if len(tokens) == 0 {
+		return status.Error(codes.Unauthenticated, "session token not provided, please upgrade pty-client")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid session token")
+	}
+
+	return nil
+}
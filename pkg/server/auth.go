@@ -0,0 +1,149 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+// SetPeerAuthorization only allows processes in the pod a device allocated
+// to connect to its session, pods are found in kubelet device manager
+// checkpoint file by resource name, applies to sessions opened or adopted
+// from now on
+func (m *SessionManager) SetPeerAuthorization(resourceName, kubeletCheckpointFile string) {
+	m.mu.Lock()
+	m.resourceName, m.kubeletCheckpointFile = resourceName, kubeletCheckpointFile
+	m.mu.Unlock()
+}
+
+// SetAllowedPeers only allows client processes running as one of uids and
+// with primary group in gids, empty to allow any, checked along with the pod
+// if peer authorization enabled, applies to sessions opened or adopted from
+// now on
+func (m *SessionManager) SetAllowedPeers(uids, gids []uint32) {
+	m.mu.Lock()
+	m.allowedPeerUIDs, m.allowedPeerGIDs = uids, gids
+	m.mu.Unlock()
+}
+
+// authorizer of the session if peer authorization enabled or peers
+// restricted
+func (m *SessionManager) authorizer(s *Session) func(cred *pty.PeerCred) error {
+	m.mu.RLock()
+	checkPod := m.kubeletCheckpointFile != ""
+	uids, gids := m.allowedPeerUIDs, m.allowedPeerGIDs
+	m.mu.RUnlock()
+
+	if !checkPod && len(uids) == 0 && len(gids) == 0 {
+		return nil
+	}
+
+	return func(cred *pty.PeerCred) error {
+		if cred == nil {
+			return fmt.Errorf("credential of client process not available")
+		}
+
+		// self dial to check service readiness
+		if cred.Pid == os.Getpid() {
+			return nil
+		}
+
+		err := checkPeerIDs(cred, uids, gids)
+		if err == nil && checkPod {
+			err = m.authorizePeer(s, cred)
+		}
+		if err != nil {
+			log.I("unauthorized client process", log.String("device", s.DeviceID),
+				log.Int("pid", cred.Pid), log.Uint32("uid", cred.Uid), log.Uint32("gid", cred.Gid), log.Err(err))
+		}
+		return err
+	}
+}
+
+// checkPeerIDs checks uid and gid of the peer process are allowed, any is
+// allowed if not restricted
+func checkPeerIDs(cred *pty.PeerCred, uids, gids []uint32) error {
+	if len(uids) > 0 && !containsID(uids, cred.Uid) {
+		return fmt.Errorf("uid %d of client process %d not allowed", cred.Uid, cred.Pid)
+	}
+
+	if len(gids) > 0 && !containsID(gids, cred.Gid) {
+		return fmt.Errorf("gid %d of client process %d not allowed", cred.Gid, cred.Pid)
+	}
+
+	return nil
+}
+
+func containsID(ids []uint32, id uint32) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizePeer checks the peer process is in the pod the device allocated
+// to by its cgroup, pod uid is remembered once any process of it authorized
+func (m *SessionManager) authorizePeer(s *Session, cred *pty.PeerCred) error {
+	cgroup, err := ioutil.ReadFile("/proc/" + strconv.Itoa(cred.Pid) + "/cgroup")
+	if err != nil {
+		return fmt.Errorf("cgroup of client process %d not found", cred.Pid)
+	}
+
+	s.mu.RLock()
+	podUID := s.podUID
+	s.mu.RUnlock()
+
+	if podUID == "" {
+		m.mu.RLock()
+		resourceName, file := m.resourceName, m.kubeletCheckpointFile
+		m.mu.RUnlock()
+
+		owners, err := loadKubeletOwners(file)
+		if err != nil {
+			return fmt.Errorf("load kubelet checkpoint failed: %v", err)
+		}
+
+		if podUID = owners[resourceName][s.DeviceID].UID; podUID == "" {
+			return fmt.Errorf("device %s not allocated to any pod", s.DeviceID)
+		}
+	}
+
+	if !inPodCgroup(string(cgroup), podUID) {
+		return fmt.Errorf("client process %d not in the pod device %s allocated to", cred.Pid, s.DeviceID)
+	}
+
+	s.mu.Lock()
+	s.podUID = podUID
+	s.mu.Unlock()
+
+	return nil
+}
+
+// inPodCgroup checks cgroup paths in /proc/<pid>/cgroup belong to the pod,
+// pod cgroups are named as `pod<uid>` by cgroupfs driver, and with dashes
+// in uid replaced by underscores by systemd driver
+func inPodCgroup(cgroup, podUID string) bool {
+	for _, name := range []string{"pod" + podUID, "pod" + strings.Replace(podUID, "-", "_", -1)} {
+		for _, line := range strings.Split(cgroup, "\n") {
+			// hierarchy-ID:controller-list:cgroup-path
+			parts := strings.SplitN(line, ":", 3)
+			if len(parts) != 3 {
+				continue
+			}
+
+			for _, dir := range strings.Split(parts[2], "/") {
+				if dir == name || strings.HasSuffix(strings.TrimSuffix(dir, ".slice"), "-"+name) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"testing"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+)
+
+func TestInPodCgroup(t *testing.T) {
+	const podUID = "1234-abcd"
+	for _, c := range []struct {
+		name     string
+		cgroup   string
+		expected bool
+	}{
+		{
+			"cgroupfs",
+			"12:pids:/kubepods/besteffort/pod1234-abcd/0123456789abcdef\n" +
+				"11:memory:/kubepods/besteffort/pod1234-abcd/0123456789abcdef\n",
+			true,
+		},
+		{
+			"cgroupfs guaranteed",
+			"4:cpu,cpuacct:/kubepods/pod1234-abcd/0123456789abcdef\n",
+			true,
+		},
+		{
+			"systemd",
+			"12:pids:/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_abcd.slice/docker-0123456789abcdef.scope\n",
+			true,
+		},
+		{
+			"systemd guaranteed",
+			"1:name=systemd:/kubepods.slice/kubepods-pod1234_abcd.slice/cri-containerd-0123.scope\n",
+			true,
+		},
+		{
+			"cgroup v2",
+			"0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234_abcd.slice/cri-containerd-0123.scope\n",
+			true,
+		},
+		{
+			"other pod",
+			"12:pids:/kubepods/besteffort/pod5678-ef01/0123456789abcdef\n",
+			false,
+		},
+		{
+			"uid prefix of other pod",
+			"12:pids:/kubepods/besteffort/pod1234-abcdef/0123\n" +
+				"11:pids:/kubepods.slice/kubepods-pod1234_abcdef.slice/docker-0123.scope\n",
+			false,
+		},
+		{
+			"uid in container id",
+			"12:pids:/kubepods/besteffort/pod5678-ef01/pod1234-abcd-0123\n",
+			false,
+		},
+		{
+			"host process",
+			"12:pids:/user.slice/user-0.slice/session-1.scope\n0::/user.slice/user-0.slice/session-1.scope\n",
+			false,
+		},
+		{"empty", "", false},
+		{"malformed", "pod1234-abcd\n", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := inPodCgroup(c.cgroup, podUID); actual != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckPeerIDs(t *testing.T) {
+	cred := &pty.PeerCred{Pid: 100, Uid: 1000, Gid: 2000}
+	for _, c := range []struct {
+		name    string
+		uids    []uint32
+		gids    []uint32
+		allowed bool
+	}{
+		{"not restricted", nil, nil, true},
+		{"uid allowed", []uint32{0, 1000}, nil, true},
+		{"uid not allowed", []uint32{0}, nil, false},
+		{"gid allowed", nil, []uint32{2000}, true},
+		{"gid not allowed", nil, []uint32{0}, false},
+		{"both allowed", []uint32{1000}, []uint32{2000}, true},
+		{"uid allowed gid not allowed", []uint32{1000}, []uint32{0}, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkPeerIDs(cred, c.uids, c.gids)
+			if allowed := err == nil; allowed != c.allowed {
+				t.Errorf("expected allowed %v, got error %v", c.allowed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+const (
+	checkpointVersion = 1
+
+	// names of files inherited by the new process during grace upgrade
+	handoffStateFileName  = "pty-sessions"
+	handoffPtmxFilePrefix = "ptmx/"
+)
+
+// CheckpointEntry is the persisted state of a session
+type CheckpointEntry struct {
+	ResourceName string    `json:"resource_name"`
+	DeviceID     string    `json:"device_id"`
+	SockDir      string    `json:"sock_dir"`
+	Pid          int       `json:"pid"`
+	StartTime    uint64    `json:"start_time"`
+	CreatedAt    time.Time `json:"created_at"`
+	Owner        PodRef    `json:"owner"`
+	// Scrollback is only passed during grace upgrade
+	Scrollback []byte `json:"scrollback,omitempty"`
+}
+
+type checkpointData struct {
+	Version  int               `json:"version"`
+	Sessions []CheckpointEntry `json:"sessions"`
+}
+
+// NewCheckpoint creates a checkpoint persisting sessions to file, sessions
+// won't be persisted if file is empty, but can still be handed over
+func NewCheckpoint(file string) *Checkpoint {
+	return &Checkpoint{
+		file:     file,
+		managers: make(map[string]*SessionManager),
+	}
+}
+
+// Checkpoint persists allocated sessions of all resources, so they can be
+// restored after plugin restart, or handed over to the new process during
+// grace upgrade
+type Checkpoint struct {
+	file       string
+	managers   map[string]*SessionManager
+	handedOver bool
+	mu         sync.Mutex
+}
+
+// Add sessions of the resource to be persisted, the checkpoint is written
+// whenever any of its sessions changed
+func (c *Checkpoint) Add(resourceName string, m *SessionManager) {
+	c.mu.Lock()
+	c.managers[resourceName] = m
+	c.mu.Unlock()
+
+	m.OnSessionChanged(func(*Session) {
+		if err := c.Save(); err != nil {
+			log.E("save checkpoint failed", log.String("file", c.file), log.Err(err))
+		}
+	})
+}
+
+// Save writes all living sessions to the checkpoint file atomically
+func (c *Checkpoint) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// sessions are owned by the new process now
+	if c.file == "" || c.handedOver {
+		return nil
+	}
+
+	content, err := json.Marshal(&checkpointData{Version: checkpointVersion, Sessions: c.entries(nil)})
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFileAtomic(c.file, content, 0600)
+}
+
+// entries of all living sessions, f is called with each of them if not nil
+func (c *Checkpoint) entries(f func(e *CheckpointEntry, s *Session)) []CheckpointEntry {
+	entries := []CheckpointEntry{}
+	for resourceName, m := range c.managers {
+		for _, s := range m.Sessions() {
+			switch s.State() {
+			case SessionServing, SessionAttached:
+			default:
+				continue
+			}
+
+			e := CheckpointEntry{
+				ResourceName: resourceName,
+				DeviceID:     s.DeviceID,
+				SockDir:      s.SockDir,
+				Pid:          s.term.Pid(),
+				StartTime:    s.term.StartTime(),
+				CreatedAt:    s.CreatedAt,
+				Owner:        s.Owner(),
+			}
+			if f != nil {
+				f(&e, s)
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		return a.ResourceName < b.ResourceName || (a.ResourceName == b.ResourceName && a.DeviceID < b.DeviceID)
+	})
+
+	return entries
+}
+
+// Handoff adds pty masters and states of all living sessions to files
+// inherited by the new process, called right before grace upgrade
+func (c *Checkpoint) Handoff() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	entries := c.entries(func(e *CheckpointEntry, s *Session) {
+		e.Scrollback = s.term.Scrollback()
+		if err == nil {
+			err = util.Net.Fds.AddFile(handoffPtmxFileName(e.ResourceName, e.DeviceID), s.term.File())
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("add pty master failed: %v", err)
+	}
+
+	content, err := json.Marshal(&checkpointData{Version: checkpointVersion, Sessions: entries})
+	if err != nil {
+		return err
+	}
+
+	// pass states with an unlinked file
+	f, err := ioutil.TempFile("", "pty-sessions")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	_ = os.Remove(f.Name())
+
+	if _, err = f.Write(content); err != nil {
+		return err
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	log.I("hand over sessions", log.Int("count", len(entries)))
+	return util.Net.Fds.AddFile(handoffStateFileName, f)
+}
+
+// Release sessions handed over without terminating them, and stop writing
+// the checkpoint file since the new process has taken over, called once the
+// new process is ready
+func (c *Checkpoint) Release() {
+	c.mu.Lock()
+	c.handedOver = true
+	managers := c.managers
+	c.mu.Unlock()
+
+	for _, m := range managers {
+		m.Release()
+	}
+}
+
+// TakeOver sessions handed over by the parent process during grace upgrade,
+// nothing is done if not started by grace upgrade
+func (c *Checkpoint) TakeOver(ctx context.Context) error {
+	f, err := util.Net.Fds.File(handoffStateFileName)
+	if err != nil || f == nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	data := &checkpointData{}
+	if err := json.NewDecoder(f).Decode(data); err != nil {
+		return err
+	}
+
+	for _, e := range data.Sessions {
+		deviceField := log.String("device", e.DeviceID)
+		resourceField := log.String("resource_name", e.ResourceName)
+
+		if err := c.takeOver(ctx, e); err != nil {
+			log.E("take over session failed", resourceField, deviceField, log.Err(err))
+
+			pty.KillOrphanSession(e.Pid, e.StartTime, 0)
+			c.finishOrphanRecording(e)
+			if err := os.RemoveAll(e.SockDir); err != nil {
+				log.E("remove pts socket dir failed", log.String("dir", e.SockDir), log.Err(err))
+			}
+			continue
+		}
+
+		log.I("session taken over", resourceField, deviceField, log.Int("pid", e.Pid))
+	}
+
+	return c.Save()
+}
+
+func (c *Checkpoint) takeOver(ctx context.Context, e CheckpointEntry) error {
+	c.mu.Lock()
+	m, ok := c.managers[e.ResourceName]
+	c.mu.Unlock()
+
+	ptmx, err := util.Net.Fds.File(handoffPtmxFileName(e.ResourceName, e.DeviceID))
+	if err != nil {
+		return err
+	}
+
+	if ptmx == nil {
+		return fmt.Errorf("pty master not inherited")
+	}
+
+	if !ok {
+		_ = ptmx.Close()
+		return fmt.Errorf("resource no longer served")
+	}
+
+	s, err := m.Adopt(ctx, e.DeviceID, ptmx, e.Pid, e.StartTime, e.CreatedAt, e.Scrollback)
+	if err != nil {
+		_ = ptmx.Close()
+		return err
+	}
+
+	m.SetOwner(s, e.Owner)
+	return nil
+}
+
+// finishOrphanRecording finalizes recording of the session failed to take over
+func (c *Checkpoint) finishOrphanRecording(e CheckpointEntry) {
+	c.mu.Lock()
+	m, ok := c.managers[e.ResourceName]
+	c.mu.Unlock()
+
+	if ok {
+		m.finishOrphanRecording(e.DeviceID, e.CreatedAt, e.Owner)
+	}
+}
+
+func handoffPtmxFileName(resourceName, deviceID string) string {
+	return handoffPtmxFilePrefix + resourceName + "/" + deviceID
+}
+
+// Load reads sessions from the checkpoint file, returns nothing if the file
+// doesn't exist
+func (c *Checkpoint) Load() ([]CheckpointEntry, error) {
+	content, err := ioutil.ReadFile(c.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	data := &checkpointData{}
+	if err := json.Unmarshal(content, data); err != nil {
+		return nil, err
+	}
+
+	return data.Sessions, nil
+}
+
+// Restore sessions in the checkpoint file, sessions whose devices are still
+// allocated according to kubelet are opened again at the same socket dir,
+// the others are cleaned up, processes left by previous shells are always
+// terminated since their terminals have gone with previous plugin process
+func (c *Checkpoint) Restore(ctx context.Context, allocated map[string]map[string]bool) error {
+	entries, err := c.Load()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		c.mu.Lock()
+		m, ok := c.managers[e.ResourceName]
+		c.mu.Unlock()
+
+		if ok {
+			if s, found := m.Get(e.DeviceID); found && s.term.Pid() == e.Pid {
+				// already taken over
+				continue
+			}
+		}
+
+		deviceField := log.String("device", e.DeviceID)
+		resourceField := log.String("resource_name", e.ResourceName)
+
+		gracePeriod := time.Duration(0)
+		if ok {
+			gracePeriod = m.config.KillGracePeriod
+		}
+		pty.KillOrphanSession(e.Pid, e.StartTime, gracePeriod)
+		if ok {
+			m.finishOrphanRecording(e.DeviceID, e.CreatedAt, e.Owner)
+		}
+
+		if !ok || !allocated[e.ResourceName][e.DeviceID] {
+			log.I("clean up session no longer allocated", resourceField, deviceField)
+			if err := os.RemoveAll(e.SockDir); err != nil {
+				log.E("remove pts socket dir failed", log.String("dir", e.SockDir), log.Err(err))
+			}
+			continue
+		}
+
+		log.I("restore session still allocated", resourceField, deviceField, log.String("owner", e.Owner.String()))
+		s, err := m.Open(ctx, e.DeviceID)
+		if err != nil {
+			log.E("restore session failed", resourceField, deviceField, log.Err(err))
+			continue
+		}
+		m.SetOwner(s, e.Owner)
+	}
+
+	// entries not restored should be removed from the file
+	return c.Save()
+}
+
+// kubeletCheckpoint is the part of kubelet device manager checkpoint we care
+type kubeletCheckpoint struct {
+	Data struct {
+		PodDeviceEntries []struct {
+			PodUID        string
+			ContainerName string
+			ResourceName  string
+			// DeviceIDs is a list of ids in old kubelet, and a map of numa
+			// node to ids in newer ones
+			DeviceIDs json.RawMessage
+		}
+	}
+}
+
+// LoadKubeletAllocations reads device ids allocated to pods from kubelet
+// device manager checkpoint, returns nothing if the file doesn't exist
+func LoadKubeletAllocations(file string) (map[string]map[string]bool, error) {
+	owners, err := loadKubeletOwners(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]map[string]bool)
+	for resourceName, devices := range owners {
+		result[resourceName] = make(map[string]bool)
+		for id := range devices {
+			result[resourceName][id] = true
+		}
+	}
+
+	return result, nil
+}
+
+// loadKubeletOwners reads containers devices allocated to from kubelet
+// device manager checkpoint by resource name and device id, only pod uid and
+// container name are known
+func loadKubeletOwners(file string) (map[string]map[string]PodRef, error) {
+	result := make(map[string]map[string]PodRef)
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	cp := &kubeletCheckpoint{}
+	if err := json.Unmarshal(content, cp); err != nil {
+		return nil, err
+	}
+
+	for _, e := range cp.Data.PodDeviceEntries {
+		var ids []string
+		if err := json.Unmarshal(e.DeviceIDs, &ids); err != nil {
+			numaIDs := make(map[string][]string)
+			if err := json.Unmarshal(e.DeviceIDs, &numaIDs); err != nil {
+				return nil, fmt.Errorf("invalid device ids of pod %s: %v", e.PodUID, err)
+			}
+
+			for _, nodeIDs := range numaIDs {
+				ids = append(ids, nodeIDs...)
+			}
+		}
+
+		if result[e.ResourceName] == nil {
+			result[e.ResourceName] = make(map[string]PodRef)
+		}
+		for _, id := range ids {
+			result[e.ResourceName][id] = PodRef{UID: e.PodUID, Container: e.ContainerName}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	m := openSessions(t, dir, "pts1", "pts0")
+	defer reclaimAll(m)
+
+	c := NewCheckpoint(filepath.Join(dir, "checkpoint"))
+	c.Add(testResourceName, m)
+
+	owner := PodRef{Namespace: "default", Name: "foo", Container: "shell"}
+	s0, _ := m.Get("pts0")
+	// saved on change
+	m.SetOwner(s0, owner)
+
+	entries, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+
+	for i, deviceID := range []string{"pts0", "pts1"} {
+		s, _ := m.Get(deviceID)
+		e := entries[i]
+		if e.ResourceName != testResourceName || e.DeviceID != deviceID || e.SockDir != s.SockDir ||
+			e.Pid != s.term.Pid() || e.StartTime != s.term.StartTime() || !e.CreatedAt.Equal(s.CreatedAt) {
+			t.Errorf("unexpected entry %d: %+v", i, e)
+		}
+	}
+	if entries[0].Owner != owner {
+		t.Errorf("expected owner %v, got %v", owner, entries[0].Owner)
+	}
+
+	// reclaimed sessions are removed
+	m.Reclaim("pts1")
+	entries, err = c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].DeviceID != "pts0" {
+		t.Errorf("expected only pts0 left, got %v", entries)
+	}
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	owner := PodRef{Namespace: "default", Name: "foo", Container: "shell"}
+
+	// sessions of previous process, its checkpoint keeps being saved when
+	// sessions are terminated, use another file to restore from
+	previous := openSessions(t, filepath.Join(dir, "previous"), "pts0", "pts1")
+	defer reclaimAll(previous)
+
+	previousFile := filepath.Join(dir, "previous", "checkpoint")
+	c := NewCheckpoint(previousFile)
+	c.Add(testResourceName, previous)
+	s0, _ := previous.Get("pts0")
+	previous.SetOwner(s0, owner)
+
+	content, err := ioutil.ReadFile(previousFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := openSessions(t, filepath.Join(dir, "current"))
+	defer reclaimAll(m)
+
+	file := filepath.Join(dir, "checkpoint")
+	c = NewCheckpoint(file)
+	c.Add(testResourceName, m)
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Restore(context.Background(), map[string]map[string]bool{testResourceName: {"pts0": true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// shells of previous sessions are terminated
+	for _, s := range previous.Sessions() {
+		select {
+		case <-s.term.Done():
+		case <-time.After(5 * time.Second):
+			t.Errorf("shell of previous session %s not terminated", s.DeviceID)
+		}
+	}
+
+	s, ok := m.Get("pts0")
+	if !ok || s.State() != SessionServing || s.Owner() != owner {
+		t.Errorf("expected session of allocated device restored with owner, got %v", s)
+	}
+
+	if _, ok := m.Get("pts1"); ok {
+		t.Error("expected session of device not allocated not restored")
+	}
+
+	entries, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].DeviceID != "pts0" || entries[0].Pid != s.term.Pid() {
+		t.Errorf("expected checkpoint with restored session only, got %v", entries)
+	}
+}
+
+func TestLoadKubeletOwners(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for _, c := range []struct {
+		name     string
+		content  string
+		expected map[string]map[string]PodRef
+		err      bool
+	}{
+		{
+			"device ids list",
+			`{"Data":{"PodDeviceEntries":[
+				{"PodUID":"1234-abcd","ContainerName":"c","ResourceName":"arhat.dev/pty","DeviceIDs":["pts0","pts1"]},
+				{"PodUID":"5678-ef01","ContainerName":"d","ResourceName":"nvidia.com/gpu","DeviceIDs":["gpu0"]}
+			],"RegisteredDevices":{"arhat.dev/pty":["pts0","pts1","pts2"]}},"Checksum":1}`,
+			map[string]map[string]PodRef{
+				"arhat.dev/pty": {
+					"pts0": {UID: "1234-abcd", Container: "c"},
+					"pts1": {UID: "1234-abcd", Container: "c"},
+				},
+				"nvidia.com/gpu": {"gpu0": {UID: "5678-ef01", Container: "d"}},
+			},
+			false,
+		},
+		{
+			"device ids by numa node",
+			`{"Data":{"PodDeviceEntries":[
+				{"PodUID":"1234-abcd","ContainerName":"c","ResourceName":"arhat.dev/pty","DeviceIDs":{"-1":["pts0"],"0":["pts1"]}}
+			]}}`,
+			map[string]map[string]PodRef{
+				"arhat.dev/pty": {
+					"pts0": {UID: "1234-abcd", Container: "c"},
+					"pts1": {UID: "1234-abcd", Container: "c"},
+				},
+			},
+			false,
+		},
+		{"no entries", `{"Data":{"PodDeviceEntries":null}}`, map[string]map[string]PodRef{}, false},
+		{"invalid json", `{"Data":`, nil, true},
+		{
+			"invalid device ids",
+			`{"Data":{"PodDeviceEntries":[{"PodUID":"1234-abcd","ResourceName":"arhat.dev/pty","DeviceIDs":"pts0"}]}}`,
+			nil,
+			true,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(dir, "kubelet_internal_checkpoint")
+			if err := ioutil.WriteFile(file, []byte(c.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			owners, err := loadKubeletOwners(file)
+			if (err != nil) != c.err {
+				t.Fatalf("expected error %v, got %v", c.err, err)
+			}
+			if !c.err && !reflect.DeepEqual(owners, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, owners)
+			}
+		})
+	}
+
+	t.Run("file not exist", func(t *testing.T) {
+		owners, err := loadKubeletOwners(filepath.Join(dir, "none"))
+		if err != nil || len(owners) != 0 {
+			t.Errorf("expected nothing, got %v %v", owners, err)
+		}
+	})
+
+	t.Run("allocations", func(t *testing.T) {
+		file := filepath.Join(dir, "kubelet_internal_checkpoint")
+		content := `{"Data":{"PodDeviceEntries":[{"PodUID":"1234-abcd","ContainerName":"c","ResourceName":"arhat.dev/pty","DeviceIDs":["pts0"]}]}}`
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		allocated, err := LoadKubeletAllocations(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := map[string]map[string]bool{"arhat.dev/pty": {"pts0": true}}; !reflect.DeepEqual(allocated, expected) {
+			t.Errorf("expected %v, got %v", expected, allocated)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"arhat.dev/kube-host-pty/pkg/metrics"
+	"arhat.dev/kube-host-pty/pkg/pty"
+)
+
+// sessionDurationBuckets in seconds, from a quick look to a long running
+// session
+var sessionDurationBuckets = []float64{
+	60, 5 * 60, 15 * 60, 30 * 60, 3600, 2 * 3600, 4 * 3600, 8 * 3600, 24 * 3600,
+}
+
+// NewMetrics creates metrics of devices and sessions of resources added
+func NewMetrics() *Metrics {
+	return &Metrics{
+		resources: make(map[string]*resourceMetrics),
+		sessionDuration: metrics.NewHistogramVec("pty_session_duration_seconds",
+			"Duration of sessions ended.", sessionDurationBuckets, "resource_name"),
+	}
+}
+
+// Metrics collects state of devices and sessions when scraped
+type Metrics struct {
+	resources       map[string]*resourceMetrics
+	sessionDuration *metrics.HistogramVec
+	mu              sync.RWMutex
+}
+
+type resourceMetrics struct {
+	sessions *SessionManager
+	plugin   PtyDevicePluginServer
+}
+
+// Add devices and sessions of the resource to be collected
+func (m *Metrics) Add(resourceName string, sessions *SessionManager, plugin PtyDevicePluginServer) {
+	m.mu.Lock()
+	m.resources[resourceName] = &resourceMetrics{sessions: sessions, plugin: plugin}
+	m.mu.Unlock()
+
+	sessions.OnSessionChanged(func(s *Session) {
+		if s.State() == SessionReclaimed {
+			m.sessionDuration.Observe(time.Since(s.CreatedAt).Seconds(), resourceName)
+		}
+	})
+}
+
+// sessionSample is a session metric of a device
+type sessionSample struct {
+	resourceName string
+	info         SessionInfo
+	stats        pty.Stats
+}
+
+func (m *Metrics) Collect(w *metrics.Writer) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.resources))
+	for name := range m.resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		deviceStats = make([]DeviceStats, len(names))
+		sessions    []sessionSample
+	)
+	for i, name := range names {
+		r := m.resources[name]
+		deviceStats[i] = r.plugin.Stats()
+
+		for _, info := range r.sessions.List() {
+			if info.State == SessionReclaimed {
+				continue
+			}
+
+			if s, ok := r.sessions.Get(info.DeviceID); ok {
+				sessions = append(sessions, sessionSample{resourceName: name, info: info, stats: s.term.Stats()})
+			}
+		}
+	}
+
+	resourceLabel := []string{"resource_name"}
+	deviceLabels := []string{"resource_name", "device"}
+
+	w.Family("pty_devices", "Devices by state.", metrics.TypeGauge)
+	for i, name := range names {
+		stats := deviceStats[i]
+		for _, s := range []struct {
+			state string
+			count int
+		}{
+			{"allocated", stats.Allocated},
+			{"available", stats.Available},
+			{"unhealthy", stats.Unhealthy},
+		} {
+			w.Sample("pty_devices", []string{"resource_name", "state"}, []string{name, s.state}, float64(s.count))
+		}
+	}
+
+	w.Family("pty_allocation_failures_total", "Device allocations failed.", metrics.TypeCounter)
+	for i, name := range names {
+		w.Sample("pty_allocation_failures_total", resourceLabel, []string{name}, float64(deviceStats[i].AllocationFailures))
+	}
+
+	w.Family("pty_sessions", "Active sessions by state.", metrics.TypeGauge)
+	for _, name := range names {
+		counts := make(map[SessionState]int)
+		for _, s := range sessions {
+			if s.resourceName == name {
+				counts[s.info.State]++
+			}
+		}
+
+		for _, state := range []SessionState{SessionAllocated, SessionServing, SessionAttached, SessionExited, SessionHandedOver} {
+			w.Sample("pty_sessions", []string{"resource_name", "state"}, []string{name, string(state)}, float64(counts[state]))
+		}
+	}
+
+	w.Family("pty_session_clients", "Clients attached to the session.", metrics.TypeGauge)
+	for _, s := range sessions {
+		labelNames := []string{"resource_name", "device", "mode"}
+		w.Sample("pty_session_clients", labelNames, []string{s.resourceName, s.info.DeviceID, "read-write"},
+			float64(s.info.Attached-s.info.Observers))
+		w.Sample("pty_session_clients", labelNames, []string{s.resourceName, s.info.DeviceID, pty.AttachModeReadOnly},
+			float64(s.info.Observers))
+	}
+
+	for _, c := range []struct {
+		name, help string
+		value      func(stats pty.Stats) uint64
+	}{
+		{"pty_session_attaches_total", "Clients ever attached to the session.", func(s pty.Stats) uint64 { return s.Attaches }},
+		{"pty_session_input_bytes_total", "Bytes of input written to the session.", func(s pty.Stats) uint64 { return s.InputBytes }},
+		{"pty_session_output_bytes_total", "Bytes of output read from the session.", func(s pty.Stats) uint64 { return s.OutputBytes }},
+	} {
+		w.Family(c.name, c.help, metrics.TypeCounter)
+		for _, s := range sessions {
+			w.Sample(c.name, deviceLabels, []string{s.resourceName, s.info.DeviceID}, float64(c.value(s.stats)))
+		}
+	}
+
+	m.sessionDuration.Collect(w)
+}
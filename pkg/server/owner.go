@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+// NewOwnerResolver finds the container a device of the resource allocated
+// to via kubelet pod-resources service, or in kubelet device manager
+// checkpoint if the service is not available, works without gc enabled
+func NewOwnerResolver(resourceName, podResourcesSocket, kubeletCheckpointFile string) func(deviceID string) (PodRef, error) {
+	return func(deviceID string) (PodRef, error) {
+		// dial blocks until timeout if the service is not enabled
+		if _, err := os.Stat(podResourcesSocket); err == nil {
+			assigned, err := listAssignedDevices(context.Background(), podResourcesSocket)
+			if err == nil {
+				if owner, ok := assigned[resourceName][deviceID]; ok {
+					return owner, nil
+				}
+			} else {
+				log.D("list kubelet pod resources failed", log.String("addr", podResourcesSocket), log.Err(err))
+			}
+		}
+
+		owners, err := loadKubeletOwners(kubeletCheckpointFile)
+		if err != nil {
+			return PodRef{}, fmt.Errorf("load kubelet checkpoint failed: %v", err)
+		}
+
+		if owner, ok := owners[resourceName][deviceID]; ok {
+			return owner, nil
+		}
+		return PodRef{}, fmt.Errorf("device %s not allocated to any pod", deviceID)
+	}
+}
+
+// SetOwnerResolver sets the function to find the container a device
+// allocated to, used when the owner of a session is not known on first
+// attach or when its recording finalized
+func (m *SessionManager) SetOwnerResolver(resolve func(deviceID string) (PodRef, error)) {
+	m.mu.Lock()
+	m.ownerResolver = resolve
+	m.mu.Unlock()
+}
+
+// resolveOwner records the container the session allocated to if not known
+func (m *SessionManager) resolveOwner(s *Session) {
+	if s.Owner() != (PodRef{}) {
+		return
+	}
+
+	owner, err := m.findOwner(s.DeviceID)
+	if err != nil {
+		log.D("session owner not found", log.String("device", s.DeviceID), log.Err(err))
+		return
+	}
+
+	log.I("session owner found", log.String("device", s.DeviceID), log.String("owner", owner.String()))
+	m.SetOwner(s, owner)
+}
+
+func (m *SessionManager) findOwner(deviceID string) (PodRef, error) {
+	m.mu.RLock()
+	resolve := m.ownerResolver
+	m.mu.RUnlock()
+
+	if resolve == nil {
+		return PodRef{}, fmt.Errorf("owner resolver not set")
+	}
+	return resolve(deviceID)
+}
@@ -5,37 +5,163 @@ import (
 	"fmt"
 	"path/filepath"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
 
 	"arhat.dev/kube-host-pty/pkg/constant"
 	"arhat.dev/kube-host-pty/pkg/pty"
-	"arhat.dev/kube-host-pty/pkg/util"
 	"arhat.dev/kube-host-pty/pkg/util/log"
 )
 
-func NewPtyDevicePluginServer(shell, rootDir string, maxPty uint8) k8sDP.DevicePluginServer {
-	return &devicePluginService{
-		shell:  shell,
-		ptyDir: rootDir,
-		devices: func() []*k8sDP.Device {
+// PtyDevicePluginServer is the device plugin service serving virtual pty devices
+type PtyDevicePluginServer interface {
+	k8sDP.DevicePluginServer
+
+	// SetDisabledDevices marks devices with provided ids as administratively
+	// disabled, they will be reported unhealthy until enabled again, running
+	// sessions of devices newly disabled are terminated
+	SetDisabledDevices(ids []string)
+
+	// Stats returns counts of devices in each state and allocation failures
+	Stats() DeviceStats
+}
+
+// DeviceStats of a device plugin service
+type DeviceStats struct {
+	Allocated int
+	Available int
+	// Unhealthy devices are disabled or with broken sessions
+	Unhealthy int
+
+	AllocationFailures uint64
+}
+
+func NewPtyDevicePluginServer(sessions *SessionManager, maxPty uint8) PtyDevicePluginServer {
+	svc := &devicePluginService{
+		sessions: sessions,
+		deviceIDs: func() []string {
 			// generate virtual pty devices
-			var devices []*k8sDP.Device
+			var ids []string
 			for i := uint8(0); i < maxPty; i++ {
-				id := fmt.Sprintf("pts%d", i)
-				devices = append(devices, &k8sDP.Device{ID: id, Health: k8sDP.Healthy})
+				ids = append(ids, fmt.Sprintf("pts%d", i))
 			}
-			return devices
+			return ids
 		}(),
+		disabled: make(map[string]bool),
+		watchers: make(map[chan struct{}]struct{}),
 	}
+
+	sessions.OnSessionChanged(func(s *Session) {
+		switch s.State() {
+		case SessionExited, SessionReclaimed, SessionServing:
+			// device health may change
+			svc.notifyDevicesChanged()
+		}
+	})
+
+	return svc
 }
 
 type devicePluginService struct {
-	shell            string
-	ptyDir           string
-	devices          []*k8sDP.Device
-	allocatedDevices sync.Map
+	sessions  *SessionManager
+	deviceIDs []string
+
+	allocationFailures uint64
+
+	// device health state
+	disabled map[string]bool
+	watchers map[chan struct{}]struct{}
+	mu       sync.RWMutex
+}
+
+// SetDisabledDevices replaces the set of administratively disabled devices
+func (svc *devicePluginService) SetDisabledDevices(ids []string) {
+	disabled := make(map[string]bool)
+	for _, id := range ids {
+		disabled[id] = true
+	}
+
+	svc.mu.Lock()
+	previous := svc.disabled
+	svc.disabled = disabled
+	svc.mu.Unlock()
+
+	log.I("disabled devices updated", log.Strings("devicesIDs", ids))
+	svc.notifyDevicesChanged()
+
+	for id := range disabled {
+		if !previous[id] {
+			svc.sessions.Terminate(id)
+		}
+	}
+}
+
+func (svc *devicePluginService) listDevices() []*k8sDP.Device {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+
+	devices := make([]*k8sDP.Device, len(svc.deviceIDs))
+	for i, id := range svc.deviceIDs {
+		health := k8sDP.Healthy
+		if svc.disabled[id] || !svc.sessionHealthy(id) {
+			health = k8sDP.Unhealthy
+		}
+		devices[i] = &k8sDP.Device{ID: id, Health: health}
+	}
+	return devices
+}
+
+func (svc *devicePluginService) Stats() DeviceStats {
+	stats := DeviceStats{AllocationFailures: atomic.LoadUint64(&svc.allocationFailures)}
+	for _, d := range svc.listDevices() {
+		switch s, ok := svc.sessions.Get(d.ID); {
+		case d.Health != k8sDP.Healthy:
+			stats.Unhealthy++
+		case ok && s.State() != SessionReclaimed:
+			stats.Allocated++
+		default:
+			stats.Available++
+		}
+	}
+	return stats
+}
+
+func (svc *devicePluginService) watchDevices() chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	svc.mu.Lock()
+	svc.watchers[ch] = struct{}{}
+	svc.mu.Unlock()
+
+	return ch
+}
+
+func (svc *devicePluginService) unwatchDevices(ch chan struct{}) {
+	svc.mu.Lock()
+	delete(svc.watchers, ch)
+	svc.mu.Unlock()
+}
+
+func (svc *devicePluginService) notifyDevicesChanged() {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+
+	for ch := range svc.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// update already pending
+		}
+	}
+}
+
+// sessionHealthy checks whether the session of the device is broken, a
+// device is unhealthy from the moment its shell or socket server has gone
+// until the session has been reclaimed
+func (svc *devicePluginService) sessionHealthy(id string) bool {
+	s, ok := svc.sessions.Get(id)
+	return !ok || s.State() != SessionExited
 }
 
 // GetDevicePluginOptions returns
@@ -43,15 +169,23 @@ func (*devicePluginService) GetDevicePluginOptions(context.Context, *k8sDP.Empty
 	return &k8sDP.DevicePluginOptions{PreStartRequired: false}, nil
 }
 
-// ListAndWatch returns all pty devices available
+// ListAndWatch returns all pty devices available, and sends updated device
+// list whenever device health changed
 func (svc *devicePluginService) ListAndWatch(_ *k8sDP.Empty, srv k8sDP.DevicePlugin_ListAndWatchServer) error {
-	if err := srv.Send(&k8sDP.ListAndWatchResponse{Devices: svc.devices}); err != nil {
-		return err
-	}
+	updateCh := svc.watchDevices()
+	defer svc.unwatchDevices(updateCh)
 
-	select {
-	case <-srv.Context().Done():
-		return nil
+	for {
+		if err := srv.Send(&k8sDP.ListAndWatchResponse{Devices: svc.listDevices()}); err != nil {
+			return err
+		}
+
+		select {
+		case <-srv.Context().Done():
+			return nil
+		case <-updateCh:
+			log.D("device health changed, sending updated devices")
+		}
 	}
 }
 
@@ -65,63 +199,30 @@ func (svc *devicePluginService) Allocate(ctx context.Context, req *k8sDP.Allocat
 		log.D("allocate pty device", log.Strings("devicesIDs", r.GetDevicesIDs()))
 		devIDs := r.GetDevicesIDs()
 		if len(devIDs) == 0 {
+			atomic.AddUint64(&svc.allocationFailures, 1)
 			return nil, fmt.Errorf("no dev id provided")
 		}
 
 		var (
-			pseudoID        = devIDs[0]
-			hostPtySockDir  = filepath.Join(svc.ptyDir, pseudoID)
-			hostPtsSockFile = filepath.Join(hostPtySockDir, pseudoID)
-			ctrPtySockDir   = "/var/run/arhat/pts/"
-			ctrPtsSockFile  = filepath.Join(ctrPtySockDir, pseudoID)
+			pseudoID       = devIDs[0]
+			ctrPtySockDir  = "/var/run/arhat/pts/"
+			ctrPtsSockFile = filepath.Join(ctrPtySockDir, pseudoID)
 		)
 
-		// NEVER try to reuse previous pts session, close if still active
-		// move this to Deallocate call if possible
-		// see https://github.com/kubernetes/kubernetes/issues/59110 for related discussion
-		if val, ok := svc.allocatedDevices.Load(pseudoID); ok {
-			term := val.(*pty.Terminal)
-			if !term.Completed() {
-				_ = term.Close()
-			}
-			svc.allocatedDevices.Delete(pseudoID)
-		}
-
 		// always allocate new pty session
-		log.D("open host pty for device allocation")
-		term, err := pty.Open(svc.shell, 80, 30)
-		if err != nil {
-			log.E("create terminal pts failed", log.Err(err))
-			return nil, fmt.Errorf("create terminal pts failed")
-		}
-
-		util.Workers.Add(func(func()) (_ interface{}, err error) {
-			addressField := log.String("addr", hostPtsSockFile)
-
-			log.I("ListenAndServe pts", addressField)
-			defer log.I("ListenAndServe pts exited", addressField)
-
-			if err = term.ListenAndServe(hostPtsSockFile); err != nil {
-				log.E("ListenAndServe pts failed", addressField)
-			}
-			return
-		})
-
-		// wait for server with a self dial
-		conn, err := util.DialGRPC(ctx, "unix", hostPtsSockFile, 5*time.Second, nil)
+		// move reclaim to Deallocate call if possible
+		sess, err := svc.sessions.Open(ctx, pseudoID)
 		if err != nil {
-			// can't dial to the pts sock destroy this pty and its services
-			log.E("dial pts service failed", log.Err(err))
-			_ = term.Close()
+			atomic.AddUint64(&svc.allocationFailures, 1)
 			return nil, err
-		} else {
-			_ = conn.Close()
 		}
 
-		svc.allocatedDevices.Store(pseudoID, term)
 		containerResp = append(containerResp, &k8sDP.ContainerAllocateResponse{
-			Envs:   map[string]string{constant.EnvironNamePtsUnixSockFile: ctrPtsSockFile},
-			Mounts: []*k8sDP.Mount{{ContainerPath: ctrPtySockDir, HostPath: hostPtySockDir}},
+			Envs: map[string]string{
+				constant.EnvironNamePtsUnixSockFile: ctrPtsSockFile,
+				constant.EnvironNamePtsTokenFile:    ctrPtsSockFile + pty.TokenFileSuffix,
+			},
+			Mounts: []*k8sDP.Mount{{ContainerPath: ctrPtySockDir, HostPath: sess.SockDir}},
 		})
 	}
 
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+)
+
+func TestDisableDevicesTerminatesSessions(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	m := openSessions(t, dir, "pts0", "pts1")
+	defer reclaimAll(m)
+
+	svc := NewPtyDevicePluginServer(m, 2)
+	svc.SetDisabledDevices([]string{"pts0"})
+
+	s0, _ := m.Get("pts0")
+	if state := s0.State(); state != SessionReclaimed {
+		t.Errorf("expected session of disabled device reclaimed, got %s", state)
+	}
+	if reason := s0.term.Exit().GetReason(); reason != pty.ExitReason_ADMIN_TERMINATED {
+		t.Errorf("expected exit reason %v, got %v", pty.ExitReason_ADMIN_TERMINATED, reason)
+	}
+
+	s1, _ := m.Get("pts1")
+	if state := s1.State(); state != SessionServing {
+		t.Errorf("expected session of enabled device kept, got %s", state)
+	}
+
+	// only devices newly disabled are terminated
+	svc.SetDisabledDevices([]string{"pts0", "pts1"})
+	if state := s1.State(); state != SessionReclaimed {
+		t.Errorf("expected session of newly disabled device reclaimed, got %s", state)
+	}
+}
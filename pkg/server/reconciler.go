@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	podresourcesapi "k8s.io/kubernetes/pkg/kubelet/apis/podresources/v1alpha1"
+
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+// NewReconciler creates a reconciler checking device assignment via kubelet
+// pod-resources service at socket every interval, sessions younger than
+// gracePeriod are never reclaimed since kubelet may not have recorded
+// their allocation yet
+func NewReconciler(socket string, interval, gracePeriod time.Duration) *Reconciler {
+	return &Reconciler{
+		socket:      socket,
+		interval:    interval,
+		gracePeriod: gracePeriod,
+		managers:    make(map[string]*SessionManager),
+	}
+}
+
+// Reconciler reclaims sessions whose owning pod no longer exists, device
+// plugins never get notified when devices are released by kubelet
+type Reconciler struct {
+	socket      string
+	interval    time.Duration
+	gracePeriod time.Duration
+
+	managers map[string]*SessionManager
+	mu       sync.RWMutex
+}
+
+// Add sessions of the resource to be reconciled
+func (r *Reconciler) Add(resourceName string, m *SessionManager) {
+	r.mu.Lock()
+	r.managers[resourceName] = m
+	r.mu.Unlock()
+}
+
+// Run reconciles periodically until context done
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reconcile(ctx); err != nil {
+				log.W("reconcile sessions with kubelet pod resources failed", log.String("addr", r.socket), log.Err(err))
+			}
+		}
+	}
+}
+
+// Reconcile lists device assignment from kubelet once, records session
+// owners and reclaims sessions not assigned to any pod
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	assigned, err := listAssignedDevices(ctx, r.socket)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for resourceName, m := range r.managers {
+		for _, s := range m.Sessions() {
+			if s.State() == SessionReclaimed {
+				continue
+			}
+
+			if owner, ok := assigned[resourceName][s.DeviceID]; ok {
+				if s.Owner() != owner {
+					log.I("session owner found", log.String("device", s.DeviceID), log.String("owner", owner.String()))
+					m.SetOwner(s, owner)
+				}
+				continue
+			}
+
+			if time.Since(s.CreatedAt) < r.gracePeriod {
+				continue
+			}
+
+			log.I("reclaim session of deleted pod",
+				log.String("resource_name", resourceName),
+				log.String("device", s.DeviceID),
+				log.String("owner", s.Owner().String()))
+			m.ReclaimSession(s)
+		}
+	}
+
+	return nil
+}
+
+// listAssignedDevices returns owner of devices indexed by resource name and device id
+func listAssignedDevices(ctx context.Context, socket string) (map[string]map[string]PodRef, error) {
+	conn, err := util.DialGRPC(ctx, "unix", socket, 5*time.Second, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	resp, err := podresourcesapi.NewPodResourcesListerClient(conn).List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := make(map[string]map[string]PodRef)
+	for _, pod := range resp.GetPodResources() {
+		for _, ctr := range pod.GetContainers() {
+			for _, dev := range ctr.GetDevices() {
+				if assigned[dev.GetResourceName()] == nil {
+					assigned[dev.GetResourceName()] = make(map[string]PodRef)
+				}
+
+				for _, id := range dev.GetDeviceIds() {
+					assigned[dev.GetResourceName()][id] = PodRef{
+						Namespace: pod.GetNamespace(),
+						Name:      pod.GetName(),
+						Container: ctr.GetName(),
+					}
+				}
+			}
+		}
+	}
+
+	return assigned, nil
+}
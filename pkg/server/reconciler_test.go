@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	podresourcesapi "k8s.io/kubernetes/pkg/kubelet/apis/podresources/v1alpha1"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+)
+
+const testResourceName = "arhat.dev/pty"
+
+// fakePodResources lists pods with devices assigned
+type fakePodResources struct {
+	pods []*podresourcesapi.PodResources
+}
+
+func (f *fakePodResources) List(context.Context, *podresourcesapi.ListPodResourcesRequest) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return &podresourcesapi.ListPodResourcesResponse{PodResources: f.pods}, nil
+}
+
+// serveFakePodResources serves pod-resources service in dir, returns the
+// socket address and the server to stop
+func serveFakePodResources(t *testing.T, dir string, pods ...*podresourcesapi.PodResources) (string, *grpc.Server) {
+	socket := filepath.Join(dir, "kubelet.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer()
+	podresourcesapi.RegisterPodResourcesListerServer(srv, &fakePodResources{pods: pods})
+	go func() { _ = srv.Serve(l) }()
+
+	return socket, srv
+}
+
+// podWithDevices is a pod with a container assigned devices of test resource
+func podWithDevices(namespace, name, container string, deviceIDs ...string) *podresourcesapi.PodResources {
+	return &podresourcesapi.PodResources{
+		Namespace: namespace,
+		Name:      name,
+		Containers: []*podresourcesapi.ContainerResources{{
+			Name: container,
+			Devices: []*podresourcesapi.ContainerDevices{{
+				ResourceName: testResourceName,
+				DeviceIds:    deviceIDs,
+			}},
+		}},
+	}
+}
+
+// openSessions opens sessions of devices in dir
+func openSessions(t *testing.T, dir string, deviceIDs ...string) *SessionManager {
+	m := NewSessionManager(pty.Config{Shell: "sh", KillGracePeriod: time.Second}, filepath.Join(dir, "pts"))
+	for _, id := range deviceIDs {
+		if _, err := m.Open(context.Background(), id); err != nil {
+			reclaimAll(m)
+			t.Fatalf("open session of %s failed: %v", id, err)
+		}
+	}
+	return m
+}
+
+func reclaimAll(m *SessionManager) {
+	for _, s := range m.Sessions() {
+		m.ReclaimSession(s)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pty-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestReconcilerReclaimsSessionsAfterGracePeriod(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	socket, srv := serveFakePodResources(t, dir, podWithDevices("default", "foo", "shell", "pts0"))
+	defer srv.Stop()
+
+	m := openSessions(t, dir, "pts0", "pts1")
+	defer reclaimAll(m)
+
+	const gracePeriod = 500 * time.Millisecond
+	r := NewReconciler(socket, time.Hour, gracePeriod)
+	r.Add(testResourceName, m)
+
+	expectState := func(deviceID string, expected SessionState) {
+		t.Helper()
+		s, ok := m.Get(deviceID)
+		if !ok {
+			t.Fatalf("session of %s not found", deviceID)
+		}
+		if state := s.State(); state != expected {
+			t.Errorf("expected session of %s %s, got %s", deviceID, expected, state)
+		}
+	}
+
+	if err := r.Reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// too young to be reclaimed
+	expectState("pts0", SessionServing)
+	expectState("pts1", SessionServing)
+
+	time.Sleep(gracePeriod)
+	if err := r.Reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectState("pts0", SessionServing)
+	expectState("pts1", SessionReclaimed)
+
+	s, _ := m.Get("pts0")
+	if owner, expected := s.Owner(), (PodRef{Namespace: "default", Name: "foo", Container: "shell"}); owner != expected {
+		t.Errorf("expected owner %v, got %v", expected, owner)
+	}
+}
+
+func TestReconcilerServiceUnavailable(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	m := openSessions(t, dir, "pts0")
+	defer reclaimAll(m)
+
+	r := NewReconciler(filepath.Join(dir, "none.sock"), time.Hour, 0)
+	r.Add(testResourceName, m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Reconcile(ctx); err == nil {
+		t.Fatal("expected error when pod-resources service unavailable")
+	}
+
+	// nothing known, nothing reclaimed
+	if s, _ := m.Get("pts0"); s.State() != SessionServing {
+		t.Errorf("expected session kept, got %s", s.State())
+	}
+}
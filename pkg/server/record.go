@@ -0,0 +1,157 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"arhat.dev/kube-host-pty/pkg/asciicast"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+const (
+	recordingFileExt = ".cast"
+	// recordingPartSuffix marks recordings of sessions not ended, they are
+	// renamed once the session ended
+	recordingPartSuffix = ".part"
+)
+
+// recording of a session in asciicast v2 format
+type recording struct {
+	file *os.File
+	*asciicast.Writer
+}
+
+// SetRecording records all sessions opened or adopted from now on in dir,
+// input is recorded as well if recordInput, empty dir disables recording
+func (m *SessionManager) SetRecording(dir string, recordInput bool) {
+	m.mu.Lock()
+	m.recordDir, m.recordInput = dir, recordInput
+	m.mu.Unlock()
+}
+
+// record starts recording the session, a recording of the session left by
+// previous process (e.g. before grace upgrade) is appended if adopted
+func (m *SessionManager) record(s *Session, adopted bool) {
+	m.mu.RLock()
+	dir, recordInput := m.recordDir, m.recordInput
+	m.mu.RUnlock()
+
+	if dir == "" {
+		return
+	}
+
+	deviceField := log.String("device", s.DeviceID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.E("create recording dir failed", deviceField, log.Err(err))
+		return
+	}
+
+	file := recordingPartFile(dir, s.DeviceID, s.CreatedAt)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	var header *asciicast.Header
+	if _, err := os.Stat(file); adopted && err == nil {
+		flags = os.O_WRONLY | os.O_APPEND
+	} else {
+		cols, rows, err := s.term.Size()
+		if err != nil {
+			log.E("get pty size failed", deviceField, log.Err(err))
+		}
+
+		header = &asciicast.Header{Width: int(cols), Height: int(rows), Title: s.DeviceID}
+		if m.config.Shell != "" {
+			header.Env = map[string]string{"SHELL": m.config.Shell}
+		}
+	}
+
+	f, err := os.OpenFile(file, flags, 0600)
+	if err != nil {
+		log.E("open recording file failed", deviceField, log.Err(err))
+		return
+	}
+
+	w, err := asciicast.NewWriter(f, s.CreatedAt, header)
+	if err != nil {
+		_ = f.Close()
+		log.E("write recording header failed", deviceField, log.Err(err))
+		return
+	}
+
+	log.I("recording session", deviceField, log.String("file", file))
+	s.recording = &recording{file: f, Writer: w}
+	s.term.Record(s.recording, recordInput, !adopted)
+}
+
+// finishRecording stops recording the session, the recording is finalized
+// unless the session has been handed over to another process
+func (m *SessionManager) finishRecording(s *Session, handedOver bool) {
+	if s.recording == nil {
+		return
+	}
+
+	s.term.Record(nil, false, false)
+	_ = s.recording.file.Close()
+	if handedOver {
+		return
+	}
+
+	m.resolveOwner(s)
+	finalizeRecording(filepath.Dir(s.recording.file.Name()), s.DeviceID, s.CreatedAt, s.Owner())
+}
+
+// finishOrphanRecording finalizes recording of a session whose terminal has
+// gone with previous process
+func (m *SessionManager) finishOrphanRecording(deviceID string, createdAt time.Time, owner PodRef) {
+	m.mu.RLock()
+	dir := m.recordDir
+	m.mu.RUnlock()
+
+	if dir == "" {
+		return
+	}
+
+	if owner == (PodRef{}) {
+		owner, _ = m.findOwner(deviceID)
+	}
+	finalizeRecording(dir, deviceID, createdAt, owner)
+}
+
+// finalizeRecording renames recording of the session to its final name with
+// the container the session allocated to, if any
+func finalizeRecording(dir, deviceID string, createdAt time.Time, owner PodRef) {
+	part := recordingPartFile(dir, deviceID, createdAt)
+	if _, err := os.Stat(part); err != nil {
+		return
+	}
+
+	file := recordingFile(dir, deviceID, createdAt, owner)
+	if err := os.Rename(part, file); err != nil {
+		log.E("finalize recording failed", log.String("file", part), log.Err(err))
+		return
+	}
+
+	log.I("recording finalized", log.String("device", deviceID), log.String("file", file))
+}
+
+// recordingFile is named as `<device>_<namespace>_<pod>_<container>_<time>.cast`,
+// or `<device>_<pod uid>_<container>_<time>.cast` if only found in kubelet
+// device manager checkpoint, pod identity is omitted if unknown
+func recordingFile(dir, deviceID string, createdAt time.Time, owner PodRef) string {
+	parts := []string{deviceID}
+	switch {
+	case owner.Name != "":
+		parts = append(parts, owner.Namespace, owner.Name, owner.Container)
+	case owner.UID != "":
+		parts = append(parts, owner.UID, owner.Container)
+	}
+	parts = append(parts, createdAt.UTC().Format("20060102T150405Z"))
+
+	return filepath.Join(dir, strings.Join(parts, "_")+recordingFileExt)
+}
+
+// recordingPartFile is named without pod identity since it's usually unknown
+// when the session opened
+func recordingPartFile(dir, deviceID string, createdAt time.Time) string {
+	return recordingFile(dir, deviceID, createdAt, PodRef{}) + recordingPartSuffix
+}
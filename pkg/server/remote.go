@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"path"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"arhat.dev/kube-host-pty/pkg/constant"
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+// NewRemoteServer creates a server serving sessions of resources added over
+// tcp, clients must present certificates verified by tlsConfig
+func NewRemoteServer(tlsConfig *tls.Config) *RemoteServer {
+	s := &RemoteServer{resources: make(map[string]*remoteResource)}
+	s.srv = pty.NewRouter(s.lookup, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	return s
+}
+
+// RemoteServer routes calls to sessions by resource name and device id in
+// call metadata, token and peer process checks of unix sockets don't apply,
+// clients are authorized by their certificates instead
+type RemoteServer struct {
+	srv       *grpc.Server
+	resources map[string]*remoteResource
+	mu        sync.RWMutex
+}
+
+type remoteResource struct {
+	sessions *SessionManager
+	// allowedClients are patterns of certificate common name or SANs
+	allowedClients []string
+}
+
+// Add sessions of the resource to be served, only clients with certificate
+// common name or any SAN matching one of allowedClients (in path.Match
+// pattern) are allowed, any client verified is allowed if empty
+func (s *RemoteServer) Add(resourceName string, sessions *SessionManager, allowedClients []string) {
+	s.mu.Lock()
+	s.resources[resourceName] = &remoteResource{sessions: sessions, allowedClients: allowedClients}
+	s.mu.Unlock()
+}
+
+// ListenAndServe on the tcp address until stopped
+func (s *RemoteServer) ListenAndServe(address string) error {
+	return util.GRPCListenAndServe(s.srv, "tcp", address)
+}
+
+func (s *RemoteServer) Stop() {
+	s.srv.Stop()
+}
+
+func (s *RemoteServer) lookup(ctx context.Context, resourceName, deviceID string) (*pty.Terminal, error) {
+	if resourceName == "" {
+		resourceName = constant.ResourceNamePty
+	}
+
+	s.mu.RLock()
+	r, ok := s.resources[resourceName]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "resource %s not found", resourceName)
+	}
+
+	cert := peerCertificate(ctx)
+	if cert == nil {
+		return nil, status.Error(codes.Unauthenticated, "client certificate not provided")
+	}
+
+	if !clientAllowed(cert, r.allowedClients) {
+		return nil, status.Errorf(codes.PermissionDenied, "client %q not allowed to access resource %s", cert.Subject.CommonName, resourceName)
+	}
+
+	session, ok := r.sessions.Get(deviceID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "device %s has no session", deviceID)
+	}
+
+	switch session.State() {
+	case SessionServing, SessionAttached:
+	default:
+		return nil, status.Errorf(codes.Unavailable, "session of device %s is %s", deviceID, session.State())
+	}
+
+	log.D("remote client authorized", log.String("resource_name", resourceName),
+		log.String("device", deviceID), log.String("client", cert.Subject.CommonName))
+	return session.term, nil
+}
+
+// peerCertificate is the verified leaf certificate of the client
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return info.State.VerifiedChains[0][0]
+}
+
+// clientAllowed checks common name and SANs of the certificate against
+// patterns
+func clientAllowed(cert *x509.Certificate, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util"
+)
+
+func TestClientAllowed(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://cluster.local/ns/ops/sa/admin")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice"},
+		DNSNames:       []string{"alice.ops.example.com"},
+		EmailAddresses: []string{"alice@example.com"},
+		URIs:           []*url.URL{spiffe},
+	}
+
+	for _, c := range []struct {
+		name     string
+		cert     *x509.Certificate
+		patterns []string
+		expected bool
+	}{
+		{"no patterns", cert, nil, true},
+		{"common name", cert, []string{"alice"}, true},
+		{"common name pattern", cert, []string{"bob", "al*"}, true},
+		{"dns name", cert, []string{"*.ops.example.com"}, true},
+		{"email", cert, []string{"*@example.com"}, true},
+		{"uri", cert, []string{"spiffe://cluster.local/ns/ops/sa/*"}, true},
+		{"star does not match separator", cert, []string{"spiffe://cluster.local/*"}, false},
+		{"not matched", cert, []string{"bob", "*.dev.example.com", "*@example.org"}, false},
+		{"partial not matched", cert, []string{"ali"}, false},
+		{"bad pattern", cert, []string{"[alice"}, false},
+		{"empty common name never matched", &x509.Certificate{}, []string{"*"}, false},
+		{"empty common name with san", &x509.Certificate{DNSNames: []string{"bob"}}, []string{"*"}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := clientAllowed(c.cert, c.patterns); actual != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+// peerWithCertificate is the context of a call from a client with the
+// verified certificate
+func peerWithCertificate(cert *x509.Certificate) context.Context {
+	var state tls.ConnectionState
+	if cert != nil {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestRemoteServerLookup(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	m := openSessions(t, dir, "pts0")
+	defer reclaimAll(m)
+
+	s := NewRemoteServer(&tls.Config{})
+	s.Add(testResourceName, m, []string{"alice"})
+
+	alice := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+	bob := &x509.Certificate{Subject: pkix.Name{CommonName: "bob"}}
+
+	for _, c := range []struct {
+		name         string
+		ctx          context.Context
+		resourceName string
+		deviceID     string
+		code         codes.Code
+	}{
+		{"allowed", peerWithCertificate(alice), testResourceName, "pts0", codes.OK},
+		{"default resource", peerWithCertificate(alice), "", "pts0", codes.OK},
+		{"resource not found", peerWithCertificate(alice), "arhat.dev/none", "pts0", codes.NotFound},
+		{"no peer", context.Background(), testResourceName, "pts0", codes.Unauthenticated},
+		{"certificate not verified", peerWithCertificate(nil), testResourceName, "pts0", codes.Unauthenticated},
+		{"client not allowed", peerWithCertificate(bob), testResourceName, "pts0", codes.PermissionDenied},
+		{"no session", peerWithCertificate(alice), testResourceName, "pts1", codes.NotFound},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			term, err := s.lookup(c.ctx, c.resourceName, c.deviceID)
+			if code := status.Code(err); code != c.code {
+				t.Fatalf("expected code %v, got %v", c.code, err)
+			}
+
+			session, _ := m.Get("pts0")
+			if err == nil && term != session.term {
+				t.Error("unexpected terminal")
+			}
+		})
+	}
+
+	session, _ := m.Get("pts0")
+	m.ReclaimSession(session)
+	if _, err := s.lookup(peerWithCertificate(alice), testResourceName, "pts0"); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected session reclaimed unavailable, got %v", err)
+	}
+}
+
+// testPKI issues certificates signed by a ca
+type testPKI struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T, dir, name string) *testPKI {
+	p := &testPKI{t: t, dir: dir}
+	p.cert, p.key = p.issue(name, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	return p
+}
+
+// issue a certificate from the template, signed by the ca, or self-signed if
+// the ca is not created yet, certificate and key are written to dir as
+// <name>.crt and <name>.key
+func (p *testPKI) issue(name string, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	p.t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parent, parentKey := template, key
+	if p.cert != nil {
+		parent, parentKey = p.cert, p.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	p.write(name+".crt", &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	p.write(name+".key", &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return cert, key
+}
+
+func (p *testPKI) write(name string, block *pem.Block) {
+	p.t.Helper()
+
+	if err := ioutil.WriteFile(filepath.Join(p.dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func (p *testPKI) issueClient(name string) {
+	p.issue(name, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+func TestRemoteServerMutualTLS(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ca := newTestPKI(t, dir, "ca")
+	ca.issue("server", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "server"},
+		DNSNames:    []string{"pty.example.com"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	ca.issueClient("alice")
+	ca.issueClient("bob")
+
+	untrusted := newTestPKI(t, dir, "untrusted-ca")
+	untrusted.issueClient("mallory")
+
+	serverConfig, err := util.NewServerTLSConfig(
+		filepath.Join(dir, "ca.crt"), filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := openSessions(t, dir, "pts0")
+	defer reclaimAll(m)
+
+	s := NewRemoteServer(serverConfig)
+	s.Add(testResourceName, m, []string{"alice"})
+	defer s.Stop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	_ = l.Close()
+
+	go func() { _ = s.ListenAndServe(address) }()
+
+	// wait until serving
+	err = util.RetryWithBackoff(context.Background(), 10*time.Millisecond, 100*time.Millisecond, 50, func() error {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		client   string
+		serverCA string
+		code     codes.Code
+	}{
+		{"allowed", "alice", "ca", codes.OK},
+		{"not allowed", "bob", "ca", codes.PermissionDenied},
+		{"no certificate", "", "ca", codes.Unavailable},
+		{"untrusted certificate", "mallory", "ca", codes.Unavailable},
+		{"untrusted server", "alice", "untrusted-ca", codes.Unavailable},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var certFile, keyFile string
+			if c.client != "" {
+				certFile, keyFile = filepath.Join(dir, c.client+".crt"), filepath.Join(dir, c.client+".key")
+			}
+
+			clientConfig, err := util.NewClientTLSConfig(
+				filepath.Join(dir, c.serverCA+".crt"), certFile, keyFile, "pty.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			conn, err := grpc.DialContext(ctx, address, grpc.WithTransportCredentials(credentials.NewTLS(clientConfig)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = conn.Close() }()
+
+			ctx = metadata.AppendToOutgoingContext(ctx,
+				pty.MetadataKeyResourceName, testResourceName, pty.MetadataKeyDevice, "pts0")
+			_, err = pty.NewTerminalClient(conn).Handshake(ctx, pty.NewHello(nil))
+			if code := status.Code(err); code != c.code {
+				t.Errorf("expected code %v, got %v", c.code, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"arhat.dev/kube-host-pty/pkg/pty"
+	"arhat.dev/kube-host-pty/pkg/util"
+	"arhat.dev/kube-host-pty/pkg/util/log"
+)
+
+type SessionState string
+
+const (
+	// SessionAllocated the shell is running, but the terminal service is not ready
+	SessionAllocated = SessionState("allocated")
+	// SessionServing the terminal service is ready for clients to attach
+	SessionServing = SessionState("serving")
+	// SessionAttached at least one client attached to the terminal
+	SessionAttached = SessionState("attached")
+	// SessionExited the shell or the terminal service has gone, and the
+	// session is being torn down
+	SessionExited = SessionState("exited")
+	// SessionReclaimed all resources of the session have been released
+	SessionReclaimed = SessionState("reclaimed")
+	// SessionHandedOver the session has been handed over to another process,
+	// its shell is still running
+	SessionHandedOver = SessionState("handed-over")
+)
+
+// PodRef identifies the container a device allocated to, only UID and
+// Container are known if found in kubelet device manager checkpoint
+type PodRef struct {
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Name      string `json:"name" yaml:"name"`
+	Container string `json:"container" yaml:"container"`
+	UID       string `json:"uid,omitempty" yaml:"uid,omitempty"`
+}
+
+func (p PodRef) String() string {
+	switch {
+	case p.Name != "":
+		return p.Namespace + "/" + p.Name + "/" + p.Container
+	case p.UID != "":
+		return p.UID + "/" + p.Container
+	default:
+		return ""
+	}
+}
+
+// SessionInfo is a snapshot of a session
+type SessionInfo struct {
+	DeviceID  string       `json:"device_id" yaml:"device_id"`
+	State     SessionState `json:"state" yaml:"state"`
+	SockFile  string       `json:"sock_file" yaml:"sock_file"`
+	Attached  int          `json:"attached" yaml:"attached"`
+	Observers int          `json:"observers" yaml:"observers"`
+	CreatedAt time.Time    `json:"created_at" yaml:"created_at"`
+	Owner     string       `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// Session is a pty session allocated to a device
+type Session struct {
+	DeviceID  string
+	SockDir   string
+	SockFile  string
+	CreatedAt time.Time
+
+	term         *pty.Terminal
+	state        SessionState
+	owner        PodRef
+	recording    *recording
+	podUID       string
+	reclaimedCh  chan struct{}
+	serverExited chan struct{}
+	mu           sync.RWMutex
+}
+
+func (s *Session) State() SessionState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+// Reclaimed returns a channel which will be closed once all resources of the
+// session have been released
+func (s *Session) Reclaimed() <-chan struct{} {
+	return s.reclaimedCh
+}
+
+func (s *Session) Info() SessionInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return SessionInfo{
+		DeviceID:  s.DeviceID,
+		State:     s.state,
+		SockFile:  s.SockFile,
+		Attached:  s.term.Attached(),
+		Observers: s.term.Observers(),
+		CreatedAt: s.CreatedAt,
+		Owner:     s.owner.String(),
+	}
+}
+
+// Owner returns the container the session allocated to, it's only known
+// after reported by kubelet
+func (s *Session) Owner() PodRef {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.owner
+}
+
+// NewSessionManager creates a session manager opening terminals with config
+// and hosting session unix sockets in sockDir
+func NewSessionManager(config pty.Config, sockDir string) *SessionManager {
+	return &SessionManager{
+		config:   config,
+		sockDir:  sockDir,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// SessionManager owns the lifecycle of all pty sessions
+type SessionManager struct {
+	config  pty.Config
+	sockDir string
+
+	recordDir   string
+	recordInput bool
+
+	// ownerResolver finds the container a device allocated to when not
+	// reported by reconciler
+	ownerResolver func(deviceID string) (PodRef, error)
+
+	// resourceName and kubeletCheckpointFile to find the pod devices
+	// allocated to, peer authorization is disabled if empty
+	resourceName          string
+	kubeletCheckpointFile string
+	// allowedPeerUIDs and allowedPeerGIDs restrict client processes, any is
+	// allowed if empty
+	allowedPeerUIDs []uint32
+	allowedPeerGIDs []uint32
+
+	sessions         map[string]*Session
+	onSessionChanged []func(s *Session)
+	mu               sync.RWMutex
+}
+
+// OnSessionChanged adds a function to be called whenever state or owner of a
+// session changed
+func (m *SessionManager) OnSessionChanged(f func(s *Session)) {
+	m.mu.Lock()
+	m.onSessionChanged = append(m.onSessionChanged, f)
+	m.mu.Unlock()
+}
+
+// SetOwner records the container the session allocated to
+func (m *SessionManager) SetOwner(s *Session, owner PodRef) {
+	s.mu.Lock()
+	changed := s.owner != owner
+	s.owner = owner
+	s.mu.Unlock()
+
+	if changed {
+		m.notifySessionChanged(s)
+	}
+}
+
+func (m *SessionManager) notifySessionChanged(s *Session) {
+	m.mu.RLock()
+	handlers := m.onSessionChanged
+	m.mu.RUnlock()
+
+	for _, f := range handlers {
+		f(s)
+	}
+}
+
+// Get returns current session of the device
+func (m *SessionManager) Get(deviceID string) (*Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[deviceID]
+	return s, ok
+}
+
+// Sessions returns all sessions including reclaimed ones
+func (m *SessionManager) Sessions() []*Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// List returns snapshots of all sessions sorted by device id
+func (m *SessionManager) List() []SessionInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		infos = append(infos, s.Info())
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].DeviceID < infos[j].DeviceID })
+	return infos
+}
+
+// Open reclaims previous session of the device if any, then opens a new
+// session and waits until its terminal service is ready
+func (m *SessionManager) Open(ctx context.Context, deviceID string) (*Session, error) {
+	// NEVER try to reuse previous pts session, close if still active
+	// see https://github.com/kubernetes/kubernetes/issues/59110 for related discussion
+	m.Reclaim(deviceID)
+
+	log.D("open host pty for device allocation", log.String("device", deviceID))
+	term, err := pty.Open(m.config, 80, 30)
+	if err != nil {
+		log.E("create terminal pts failed", log.Err(err))
+		return nil, fmt.Errorf("create terminal pts failed")
+	}
+
+	return m.start(ctx, deviceID, term, time.Now(), false)
+}
+
+// Adopt takes over a session handed over from another process with its pty
+// master, shell process and recent output, the session is served at the same
+// socket
+func (m *SessionManager) Adopt(ctx context.Context, deviceID string, ptmx *os.File, pid int, startTime uint64, createdAt time.Time, scrollback []byte) (*Session, error) {
+	m.Reclaim(deviceID)
+
+	log.D("adopt host pty handed over", log.String("device", deviceID), log.Int("pid", pid))
+	term, err := pty.Adopt(m.config, ptmx, pid, startTime, scrollback)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.start(ctx, deviceID, term, createdAt, true)
+}
+
+// start serves the terminal as the session of the device and waits until its
+// terminal service is ready, adopted terminals continue recording left by
+// previous process
+func (m *SessionManager) start(ctx context.Context, deviceID string, term *pty.Terminal, createdAt time.Time, adopted bool) (*Session, error) {
+	sockDir := filepath.Join(m.sockDir, deviceID)
+	s := &Session{
+		DeviceID:     deviceID,
+		SockDir:      sockDir,
+		SockFile:     filepath.Join(sockDir, deviceID),
+		CreatedAt:    createdAt,
+		state:        SessionAllocated,
+		term:         term,
+		reclaimedCh:  make(chan struct{}),
+		serverExited: make(chan struct{}),
+	}
+
+	term.OnAttachChange(func(attached int) {
+		if attached > 0 {
+			m.transit(s, SessionAttached, SessionServing)
+			// the pod is surely alive when its clients attached
+			go m.resolveOwner(s)
+		} else {
+			m.transit(s, SessionServing, SessionAttached)
+		}
+	})
+
+	token := ""
+	if adopted {
+		// clients attached are still using the token written before
+		token, _ = pty.ReadTokenFile(s.SockFile + pty.TokenFileSuffix)
+	}
+	if token == "" {
+		var err error
+		if token, err = pty.NewToken(); err != nil {
+			_ = term.Close()
+			return nil, fmt.Errorf("generate session token failed: %v", err)
+		}
+	}
+	term.SetToken(token)
+
+	m.record(s, adopted)
+	term.SetAuthorizer(m.authorizer(s))
+
+	m.mu.Lock()
+	m.sessions[deviceID] = s
+	m.mu.Unlock()
+
+	m.serve(s)
+
+	// wait for server with a self dial
+	conn, err := util.DialGRPC(ctx, "unix", s.SockFile, 5*time.Second, nil)
+	if err != nil {
+		// can't dial to the pts sock destroy this pty and its services
+		log.E("dial pts service failed", log.Err(err))
+		m.Reclaim(deviceID)
+		return nil, err
+	}
+	_ = conn.Close()
+
+	m.transit(s, SessionServing, SessionAllocated)
+	return s, nil
+}
+
+// Release lets go of all sessions without terminating their shells, used
+// after sessions have been handed over to another process
+func (m *SessionManager) Release() {
+	for _, s := range m.Sessions() {
+		_ = s.term.Release()
+		<-s.reclaimedCh
+	}
+}
+
+// Reclaim closes current session of the device and waits until all its
+// resources released
+func (m *SessionManager) Reclaim(deviceID string) {
+	s, ok := m.Get(deviceID)
+	if !ok {
+		return
+	}
+
+	m.ReclaimSession(s)
+}
+
+// Terminate closes current session of the device by the administrator and
+// waits until all its resources released, clients are told the reason
+func (m *SessionManager) Terminate(deviceID string) {
+	s, ok := m.Get(deviceID)
+	if !ok || s.State() == SessionReclaimed {
+		return
+	}
+
+	log.I("terminate session", log.String("device", deviceID))
+	_ = s.term.CloseWithReason(pty.ExitReason_ADMIN_TERMINATED)
+	<-s.reclaimedCh
+}
+
+// ReclaimSession closes the session and waits until all its resources released
+func (m *SessionManager) ReclaimSession(s *Session) {
+	_ = s.term.Close()
+	<-s.reclaimedCh
+}
+
+// serve starts the terminal service of the session, once the shell or the
+// service has gone, tears down the rest and removes the socket dir
+func (m *SessionManager) serve(s *Session) {
+	addressField := log.String("addr", s.SockFile)
+
+	util.Workers.Add(func(func()) (_ interface{}, err error) {
+		defer close(s.serverExited)
+
+		log.I("ListenAndServe pts", addressField)
+		defer log.I("ListenAndServe pts exited", addressField)
+
+		if err = s.term.ListenAndServe(s.SockFile); err != nil {
+			log.E("ListenAndServe pts failed", addressField, log.Err(err))
+		}
+		return
+	}, func(func()) (interface{}, error) {
+		defer close(s.reclaimedCh)
+
+		select {
+		case <-s.term.Done():
+			log.I("pty shell exited", log.String("device", s.DeviceID))
+		case <-s.serverExited:
+			log.I("pts server exited", log.String("device", s.DeviceID))
+		}
+
+		if s.term.Released() {
+			<-s.serverExited
+			m.finishRecording(s, true)
+			m.transit(s, SessionHandedOver)
+			return nil, nil
+		}
+
+		m.transit(s, SessionExited)
+
+		_ = s.term.Close()
+		<-s.term.Done()
+		<-s.serverExited
+		m.finishRecording(s, false)
+
+		if err := os.RemoveAll(s.SockDir); err != nil {
+			log.E("remove pts socket dir failed", addressField, log.Err(err))
+		}
+
+		m.transit(s, SessionReclaimed)
+		return nil, nil
+	})
+}
+
+// transit changes state of the session, if from states are provided, only
+// change when current state is one of them
+func (m *SessionManager) transit(s *Session, to SessionState, from ...SessionState) {
+	s.mu.Lock()
+	if len(from) > 0 {
+		matched := false
+		for _, f := range from {
+			if s.state == f {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			s.mu.Unlock()
+			return
+		}
+	}
+
+	changed := s.state != to
+	s.state = to
+	s.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	log.D("session state changed", log.String("device", s.DeviceID), log.String("state", string(to)))
+	m.notifySessionChanged(s)
+}
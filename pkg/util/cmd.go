@@ -39,12 +39,14 @@ func DefaultCmd(name string, optFromConfigFile interface{}, onConfigChanged func
 					}
 				}
 
-				if onConfigChanged != nil {
+				if onConfigChanged != nil && configFile != "" {
 					Workers.Add(func(func()) (interface{}, error) {
-						newOptions := reflect.New(reflect.TypeOf(optFromConfigFile)).Elem().Interface()
-						updateCh := NotifyWhenConfigChanged(configFile, newOptions, yaml.Unmarshal)
-						for range updateCh {
-							onConfigChanged(newOptions)
+						// a new value every time, the one sent is owned by the receiver
+						newOptions := func() interface{} {
+							return reflect.New(reflect.TypeOf(optFromConfigFile).Elem()).Interface()
+						}
+						for newOpt := range NotifyWhenConfigChanged(configFile, newOptions, yaml.Unmarshal) {
+							onConfigChanged(newOpt)
 						}
 
 						return nil, nil
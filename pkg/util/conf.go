@@ -2,6 +2,8 @@ package util
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 func Unmarshal(file string, out interface{}, unmarshalFunc func([]byte, interface{}) error) error {
@@ -18,12 +20,16 @@ func Unmarshal(file string, out interface{}, unmarshalFunc func([]byte, interfac
 	return nil
 }
 
-func NotifyWhenConfigChanged(file string, out interface{}, unmarshalFunc func([]byte, interface{}) error) <-chan struct{} {
+// NotifyWhenConfigChanged unmarshals the file into a new value created by
+// newOut every time the file is written and sends the value, keys removed
+// from the file are left zero in the value sent, empty content (e.g. the
+// file truncated before written) is ignored
+func NotifyWhenConfigChanged(file string, newOut func() interface{}, unmarshalFunc func([]byte, interface{}) error) <-chan interface{} {
 	Workers.Add(func(sigContinue func()) (interface{}, error) {
 		return nil, nil
 	})
 
-	fileChangedCh := make(chan struct{}, 1)
+	fileChangedCh := make(chan interface{}, 1)
 	if ch, err := WatchFileWrite(file); err == nil {
 		Workers.Add(func(continueFunc func()) (val interface{}, err error) {
 			for {
@@ -34,14 +40,54 @@ func NotifyWhenConfigChanged(file string, out interface{}, unmarshalFunc func([]
 						return
 					}
 
-					if err := Unmarshal(file, out, unmarshalFunc); err != nil {
+					config, err := ioutil.ReadFile(file)
+					if err != nil || len(config) == 0 {
 						continue
 					}
 
-					fileChangedCh <- struct{}{}
+					out := newOut()
+					if err := unmarshalFunc(config, out); err != nil {
+						continue
+					}
+
+					fileChangedCh <- out
 				}
 			}
 		})
 	}
 	return fileChangedCh
 }
+
+// WriteFileAtomic writes data to a temporary file in the same dir and then
+// renames it to file, so readers never see partially written content
+func WriteFileAtomic(file string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpFile := f.Name()
+	defer func() { _ = os.Remove(tmpFile) }()
+
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmpFile, perm)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, file)
+}
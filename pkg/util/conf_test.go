@@ -0,0 +1,79 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type testConfig struct {
+	Shell           string   `yaml:"shell"`
+	DisabledDevices []string `yaml:"disabled_devices"`
+}
+
+// waitConfig waits for the config expected, configs sent before are skipped
+func waitConfig(t *testing.T, ch <-chan interface{}, expected *testConfig) *testConfig {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case v := <-ch:
+			if actual := v.(*testConfig); reflect.DeepEqual(actual, expected) {
+				return actual
+			}
+		case <-timeout:
+			t.Fatalf("config %+v not received", expected)
+		}
+	}
+}
+
+func TestNotifyWhenConfigChanged(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("shell: sh\n")
+	ch := NotifyWhenConfigChanged(file, func() interface{} { return &testConfig{} }, yaml.Unmarshal)
+
+	write("shell: bash\ndisabled_devices: [pts0, pts1]\n")
+	disabled := waitConfig(t, ch, &testConfig{Shell: "bash", DisabledDevices: []string{"pts0", "pts1"}})
+
+	// key removed
+	write("shell: bash\n")
+	waitConfig(t, ch, &testConfig{Shell: "bash"})
+
+	// empty content is ignored
+	write("")
+	write("shell: zsh\n")
+	timeout := time.After(5 * time.Second)
+	for received := false; !received; {
+		select {
+		case v := <-ch:
+			actual := v.(*testConfig)
+			if actual.Shell == "" {
+				t.Fatalf("empty config sent")
+			}
+			received = actual.Shell == "zsh"
+		case <-timeout:
+			t.Fatal("config not received")
+		}
+	}
+
+	// values sent are never modified
+	if !reflect.DeepEqual(disabled, &testConfig{Shell: "bash", DisabledDevices: []string{"pts0", "pts1"}}) {
+		t.Errorf("config sent modified: %+v", disabled)
+	}
+}
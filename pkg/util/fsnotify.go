@@ -1,6 +1,8 @@
 package util
 
 import (
+	"path/filepath"
+
 	"github.com/fsnotify/fsnotify"
 )
 
@@ -11,6 +13,11 @@ var (
 
 type FileEventChan struct {
 	Write chan struct{}
+
+	// Create and Remove are buffered and never block the event loop,
+	// multiple events may be merged into one if not consumed in time
+	Create chan struct{}
+	Remove chan struct{}
 }
 
 func init() {
@@ -37,6 +44,14 @@ func init() {
 								fevtCh.Write <- struct{}{}
 							}
 						}
+
+						if event.Op&fsnotify.Create == fsnotify.Create {
+							notifyNonBlocking(fevtCh.Create)
+						}
+
+						if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+							notifyNonBlocking(fevtCh.Remove)
+						}
 					}
 				}
 			}
@@ -44,6 +59,17 @@ func init() {
 	}
 }
 
+func notifyNonBlocking(ch chan struct{}) {
+	if ch == nil {
+		return
+	}
+
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
 func WatchFileWrite(file string) (*FileEventChan, error) {
 	if err := fsWatcher.Add(file); err != nil {
 		return nil, err
@@ -69,3 +95,24 @@ func UnWatchFileWrite(file string) error {
 	watchedFile.Del(file)
 	return nil
 }
+
+// WatchFileCreateRemove watches creation and removal of the file by watching
+// its parent dir, so the file doesn't need to exist when called
+func WatchFileCreateRemove(file string) (*FileEventChan, error) {
+	file = filepath.Clean(file)
+	if err := fsWatcher.Add(filepath.Dir(file)); err != nil {
+		return nil, err
+	}
+
+	var fevtCh *FileEventChan
+	if v, ok := watchedFile.Get(file); ok && v != nil {
+		fevtCh = v.(*FileEventChan)
+	} else {
+		fevtCh = &FileEventChan{}
+	}
+	fevtCh.Create = make(chan struct{}, 1)
+	fevtCh.Remove = make(chan struct{}, 1)
+
+	watchedFile.Set(file, fevtCh)
+	return fevtCh, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -13,14 +14,60 @@ import (
 	"github.com/cloudflare/tableflip"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+
+	"arhat.dev/kube-host-pty/pkg/util/log"
 )
 
 var (
 	netOnce = &sync.Once{}
 	Net, _  = tableflip.New(tableflip.Options{UpgradeTimeout: tableflip.DefaultUpgradeTimeout})
 	N       = Net.Fds
+
+	beforeUpgrade []func() error
+	afterUpgrade  []func()
+	upgradeMu     = &sync.Mutex{}
 )
 
+// BeforeGraceUpgrade adds a function to be called before starting the new
+// process, usually to add files to be inherited, the upgrade is canceled
+// if it failed
+func BeforeGraceUpgrade(f func() error) {
+	upgradeMu.Lock()
+	beforeUpgrade = append(beforeUpgrade, f)
+	upgradeMu.Unlock()
+}
+
+// AfterGraceUpgrade adds a function to be called once the new process is
+// ready, before exiting this application
+func AfterGraceUpgrade(f func()) {
+	upgradeMu.Lock()
+	afterUpgrade = append(afterUpgrade, f)
+	upgradeMu.Unlock()
+}
+
+func prepareGraceUpgrade() error {
+	upgradeMu.Lock()
+	hooks := beforeUpgrade
+	upgradeMu.Unlock()
+
+	for _, f := range hooks {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func finishGraceUpgrade() {
+	upgradeMu.Lock()
+	hooks := afterUpgrade
+	upgradeMu.Unlock()
+
+	for _, f := range hooks {
+		f()
+	}
+}
+
 func InitGraceUpgrade(exit context.CancelFunc, timeout time.Duration, sig os.Signal) {
 	netOnce.Do(func() {
 		sigCh := make(chan os.Signal, 1)
@@ -29,6 +76,7 @@ func InitGraceUpgrade(exit context.CancelFunc, timeout time.Duration, sig os.Sig
 		go func() {
 			// wait for application upgrade finish
 			<-Net.Exit()
+			finishGraceUpgrade()
 			// upgrade done, exit this application
 			exit()
 			// in case not exit, force exit
@@ -37,6 +85,11 @@ func InitGraceUpgrade(exit context.CancelFunc, timeout time.Duration, sig os.Sig
 
 		go func() {
 			for range sigCh {
+				if err := prepareGraceUpgrade(); err != nil {
+					log.E("prepare grace upgrade failed", log.Err(err))
+					continue
+				}
+
 				err := Net.Upgrade()
 				if err != nil {
 					continue
@@ -49,13 +102,14 @@ func InitGraceUpgrade(exit context.CancelFunc, timeout time.Duration, sig os.Sig
 	})
 }
 
-func DialGRPC(ctx context.Context, proto, address string, timeout time.Duration, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
-	ctx, _ = context.WithTimeout(ctx, timeout)
+func DialGRPC(ctx context.Context, proto, address string, timeout time.Duration, tlsConfig *tls.Config, extraOptions ...grpc.DialOption) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
 	options := []grpc.DialOption{
 		grpc.WithBlock(),
 		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
-			return (&net.Dialer{Timeout: timeout}).DialContext(ctx, proto, address)
+			return (&net.Dialer{Timeout: timeout}).Dial(proto, address)
 		}),
 	}
 
@@ -65,7 +119,7 @@ func DialGRPC(ctx context.Context, proto, address string, timeout time.Duration,
 		options = append(options, grpc.WithInsecure())
 	}
 
-	conn, err := grpc.DialContext(ctx, address, options...)
+	conn, err := grpc.DialContext(ctx, address, append(options, extraOptions...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -74,20 +128,44 @@ func DialGRPC(ctx context.Context, proto, address string, timeout time.Duration,
 }
 
 func GRPCListenAndServe(server *grpc.Server, proto, address string) error {
+	listen, err := Listen(proto, address)
+	if err != nil {
+		return err
+	}
+
+	return server.Serve(listen)
+}
+
+// HTTPListenAndServe serves http at the tcp address, the listener is
+// inherited by the new process during grace upgrade
+func HTTPListenAndServe(server *http.Server, address string) error {
+	listen, err := Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	return server.Serve(listen)
+}
+
+// Listen returns the listener inherited from the parent process if any,
+// or listens at the address, previous unix socket file is removed
+func Listen(proto, address string) (net.Listener, error) {
+	// listener inherited from the parent process during grace upgrade is
+	// still bound to the socket file, never remove it
+	listen, err := Net.Fds.Listener(proto, address)
+	if err != nil || listen != nil {
+		return listen, err
+	}
+
 	if proto == "unix" {
 		if err := os.MkdirAll(filepath.Dir(address), 0755); err != nil && !os.IsExist(err) {
-			return err
+			return nil, err
 		}
 
 		if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
-			return err
+			return nil, err
 		}
 	}
 
-	listen, err := Net.Fds.Listen(proto, address)
-	if err != nil {
-		return err
-	}
-
-	return server.Serve(listen)
+	return Net.Fds.Listen(proto, address)
 }
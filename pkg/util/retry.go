@@ -0,0 +1,33 @@
+package util
+
+import (
+	"context"
+	"time"
+)
+
+// RetryWithBackoff calls f until it succeeds, the context is done or maxRetry
+// (if positive) retries have been made, the wait between two calls starts
+// from initial and doubles after each failure, but never exceeds max
+func RetryWithBackoff(ctx context.Context, initial, max time.Duration, maxRetry int, f func() error) error {
+	wait := initial
+	for retry := 0; ; retry++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		if maxRetry > 0 && retry >= maxRetry {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		if wait *= 2; wait > max {
+			wait = max
+		}
+	}
+}
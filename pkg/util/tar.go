@@ -0,0 +1,224 @@
+package util
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// WriteTar writes content of dir as a tar stream, only directories, regular
+// files and symlinks are included, permission bits are reset to defaults if
+// not preserveMode
+func WriteTar(w io.Writer, dir string, preserveMode bool) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+
+		link := ""
+		switch mode := info.Mode(); {
+		case mode.IsDir(), mode.IsRegular():
+		case mode&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if !preserveMode {
+			hdr.Mode = defaultMode(info.Mode())
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// ExtractTar extracts tar stream into dir, entries not inside dir are
+// rejected, only directories, regular files and symlinks are extracted,
+// fn is called with each entry extracted if not nil
+func ExtractTar(r io.Reader, dir string, fn func(path string, hdr *tar.Header) error) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	// permission bits of directories are applied at last, in case they are
+	// not writable
+	dirModes := make(map[string]os.FileMode)
+	var dirs []string
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid tar entry %q", hdr.Name)
+		}
+
+		path := filepath.Join(root, name)
+		if path == root {
+			continue
+		}
+
+		// parent dirs may be symlinks extracted before, check before
+		// creating any of them
+		if err := checkInside(root, filepath.Dir(path)); err != nil {
+			return fmt.Errorf("tar entry %q is outside of %q: %v", hdr.Name, dir, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			// never create or chmod through symlink extracted before
+			if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("tar entry %q is a symlink extracted before", hdr.Name)
+			}
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			if _, ok := dirModes[path]; !ok {
+				dirs = append(dirs, path)
+			}
+			dirModes[path] = mode
+		case tar.TypeReg:
+			if err := extractFile(tr, path, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			_ = os.Remove(path)
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+
+		if fn != nil {
+			if err := fn(path, hdr); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := chmodDir(dirs[i], dirModes[dirs[i]]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkInside checks path resolves to root or a path inside it, components
+// not existing yet are not symlinks, so only the deepest existing ancestor
+// is resolved
+func checkInside(root, path string) error {
+	for p := path; ; p = filepath.Dir(p) {
+		resolved, err := filepath.EvalSymlinks(p)
+		if os.IsNotExist(err) && p != root {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+			return fmt.Errorf("%q resolves to %q", path, resolved)
+		}
+		return nil
+	}
+}
+
+// chmodDir changes mode of the dir, the dir may have been replaced by a
+// symlink by later entries, never follow it
+func chmodDir(path string, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	return f.Chmod(mode)
+}
+
+func extractFile(r io.Reader, path string, mode os.FileMode) error {
+	// do not write through symlink
+	_ = os.Remove(path)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	return f.Chmod(mode)
+}
+
+// defaultMode of newly created files, executables are kept executable
+func defaultMode(mode os.FileMode) int64 {
+	switch {
+	case mode.IsDir(), mode.Perm()&0111 != 0:
+		return 0755
+	default:
+		return 0644
+	}
+}
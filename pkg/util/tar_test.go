@@ -0,0 +1,288 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+	mode     int64
+}
+
+func newTar(t *testing.T, entries ...tarEntry) *bytes.Buffer {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     mode,
+			Size:     int64(len(e.content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "util-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestExtractTarRejectsEntriesOutside(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"parent", []tarEntry{{name: "../escaped", typeflag: tar.TypeReg, content: "x"}}},
+		{"nested parent", []tarEntry{{name: "a/../../escaped", typeflag: tar.TypeReg, content: "x"}}},
+		{"absolute", []tarEntry{{name: "/escaped", typeflag: tar.TypeReg, content: "x"}}},
+		{"absolute dir", []tarEntry{{name: "/escaped/", typeflag: tar.TypeDir}}},
+		{"through absolute symlink", []tarEntry{
+			{name: "link", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "link/escaped", typeflag: tar.TypeReg, content: "x"},
+		}},
+		{"through relative symlink", []tarEntry{
+			{name: "link", typeflag: tar.TypeSymlink, linkname: "../outside"},
+			{name: "link/escaped", typeflag: tar.TypeReg, content: "x"},
+		}},
+		{"through nested symlink", []tarEntry{
+			{name: "a/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "a/link", typeflag: tar.TypeSymlink, linkname: "../../outside"},
+			{name: "a/link/b/escaped", typeflag: tar.TypeReg, content: "x"},
+		}},
+		{"parent dirs through symlink", []tarEntry{
+			{name: "link", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "link/b/escaped", typeflag: tar.TypeReg, content: "x"},
+		}},
+		{"dir through symlink", []tarEntry{
+			{name: "link", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "link/", typeflag: tar.TypeDir, mode: 0777},
+		}},
+		{"dir replaced by symlink", []tarEntry{
+			{name: "link/", typeflag: tar.TypeDir, mode: 0777},
+			{name: "link", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			base := tempDir(t)
+			defer func() { _ = os.RemoveAll(base) }()
+
+			dir := filepath.Join(base, "dir")
+			outside := filepath.Join(base, "outside")
+			if err := os.Mkdir(outside, 0700); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range c.entries {
+				if c.entries[i].linkname == "OUTSIDE" {
+					c.entries[i].linkname = outside
+				}
+			}
+
+			if err := ExtractTar(newTar(t, c.entries...), dir, nil); err == nil {
+				t.Error("expected error")
+			}
+
+			for _, p := range []string{
+				filepath.Join(base, "escaped"), filepath.Join(outside, "escaped"), filepath.Join(outside, "b"), "/escaped",
+			} {
+				if _, err := os.Lstat(p); err == nil {
+					t.Errorf("unexpected file %s extracted", p)
+				}
+			}
+
+			if info, err := os.Stat(outside); err != nil || info.Mode().Perm() != 0700 {
+				t.Errorf("mode of dir outside changed: %v %v", info.Mode(), err)
+			}
+		})
+	}
+}
+
+func TestExtractTarDoesNotWriteThroughSymlink(t *testing.T) {
+	base := tempDir(t)
+	defer func() { _ = os.RemoveAll(base) }()
+
+	dir := filepath.Join(base, "dir")
+	target := filepath.Join(base, "target")
+	if err := ioutil.WriteFile(target, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ExtractTar(newTar(t,
+		tarEntry{name: "file", typeflag: tar.TypeSymlink, linkname: target},
+		tarEntry{name: "file", typeflag: tar.TypeReg, content: "replaced"},
+	), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := ioutil.ReadFile(target); string(data) != "original" {
+		t.Errorf("symlink target overwritten: %q", data)
+	}
+
+	info, err := os.Lstat(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Mode().IsRegular() {
+		t.Errorf("expected regular file, got %v", info.Mode())
+	}
+}
+
+func TestExtractTar(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	var extracted []string
+	err := ExtractTar(newTar(t,
+		tarEntry{name: "./", typeflag: tar.TypeDir, mode: 0755},
+		tarEntry{name: "ro/", typeflag: tar.TypeDir, mode: 0555},
+		tarEntry{name: "ro/file", typeflag: tar.TypeReg, content: "content", mode: 0600},
+		tarEntry{name: "ro/link", typeflag: tar.TypeSymlink, linkname: "file"},
+		tarEntry{name: "implicit/exec", typeflag: tar.TypeReg, content: "#!/bin/sh", mode: 0755},
+		tarEntry{name: "fifo", typeflag: tar.TypeFifo},
+	), dir, func(path string, hdr *tar.Header) error {
+		extracted = append(extracted, hdr.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chmod(filepath.Join(dir, "ro"), 0755) }()
+
+	if expected := []string{"ro/", "ro/file", "ro/link", "implicit/exec"}; !reflect.DeepEqual(extracted, expected) {
+		t.Errorf("expected entries %v extracted, got %v", expected, extracted)
+	}
+
+	for _, c := range []struct {
+		path string
+		mode os.FileMode
+	}{
+		{"ro", os.ModeDir | 0555},
+		{"ro/file", 0600},
+		{"implicit", os.ModeDir | 0755},
+		{"implicit/exec", 0755},
+	} {
+		info, err := os.Lstat(filepath.Join(dir, c.path))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if info.Mode() != c.mode {
+			t.Errorf("expected mode %v of %s, got %v", c.mode, c.path, info.Mode())
+		}
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "ro", "link")); string(data) != "content" {
+		t.Errorf("unexpected content via symlink: %q", data)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dir, "fifo")); err == nil {
+		t.Error("unexpected fifo extracted")
+	}
+}
+
+func TestWriteTarExtractTar(t *testing.T) {
+	src := tempDir(t)
+	defer func() { _ = os.RemoveAll(src) }()
+
+	if err := os.MkdirAll(filepath.Join(src, "a", "b"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "a", "file"), []byte("file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "a", "b", "exec"), []byte("exec"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../file", filepath.Join(src, "a", "b", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		preserveMode bool
+		modes        map[string]os.FileMode
+	}{
+		{true, map[string]os.FileMode{
+			"a": os.ModeDir | 0700, "a/b": os.ModeDir | 0700, "a/file": 0600, "a/b/exec": 0700,
+		}},
+		{false, map[string]os.FileMode{
+			"a": os.ModeDir | 0755, "a/b": os.ModeDir | 0755, "a/file": 0644, "a/b/exec": 0755,
+		}},
+	} {
+		buf := new(bytes.Buffer)
+		if err := WriteTar(buf, src, c.preserveMode); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := tempDir(t)
+		defer func() { _ = os.RemoveAll(dst) }()
+
+		var names []string
+		if err := ExtractTar(buf, dst, func(path string, hdr *tar.Header) error {
+			names = append(names, hdr.Name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Strings(names)
+		if expected := []string{"a/", "a/b/", "a/b/exec", "a/b/link", "a/file"}; !reflect.DeepEqual(names, expected) {
+			t.Errorf("expected entries %v, got %v", expected, names)
+		}
+
+		for p, mode := range c.modes {
+			info, err := os.Lstat(filepath.Join(dst, p))
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if info.Mode() != mode {
+				t.Errorf("preserve mode %v: expected mode %v of %s, got %v", c.preserveMode, mode, p, info.Mode())
+			}
+		}
+
+		if link, _ := os.Readlink(filepath.Join(dst, "a", "b", "link")); link != "../file" {
+			t.Errorf("unexpected symlink %q", link)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package version
 
 import (
 	"runtime"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -45,3 +47,49 @@ func GoVersion() string { return runtime.Version() }
 
 // BuildSys the system environment
 func BuildSys() string { return runtime.GOOS + "/" + runtime.GOARCH }
+
+// Compare versions in form of [v]MAJOR[.MINOR[.PATCH]], anything after "-"
+// or "+" is ignored, returns -1, 0 or 1 when a is older than, the same as or
+// newer than b, ok is false if any of them is not in this form (e.g. dev
+// builds)
+func Compare(a, b string) (result int, ok bool) {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+
+	for i := range va {
+		switch {
+		case va[i] < vb[i]:
+			return -1, true
+		case va[i] > vb[i]:
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+func parseVersion(v string) ([3]uint64, bool) {
+	var result [3]uint64
+
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) > len(result) {
+		return result, false
+	}
+
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return result, false
+		}
+		result[i] = n
+	}
+
+	return result, true
+}